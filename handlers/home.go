@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"html/template"
+	"log"
 	"net/http"
 	"path/filepath"
+	"video-subtitle-generator/services"
 )
 
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
@@ -16,8 +18,43 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = tmpl.ExecuteTemplate(w, "layout.html", nil)
+	data := map[string]interface{}{
+		"Library": library(),
+	}
+
+	err = tmpl.ExecuteTemplate(w, "layout.html", data)
 	if err != nil {
 		http.Error(w, "Could not render template", http.StatusInternalServerError)
 	}
 }
+
+// libraryItem is a past upload together with the state of its latest job,
+// if any.
+type libraryItem struct {
+	Media *services.Media
+	State services.JobState
+}
+
+// library lists past uploads for the home page, newest first.
+func library() []libraryItem {
+	if store == nil {
+		return nil
+	}
+	list, err := store.ListMedia()
+	if err != nil {
+		log.Printf("Failed to list media: %v", err)
+		return nil
+	}
+
+	items := make([]libraryItem, 0, len(list))
+	for _, media := range list {
+		item := libraryItem{Media: media}
+		if media.JobID != "" {
+			if state, err := store.GetJobState(media.JobID); err == nil {
+				item.State = state
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
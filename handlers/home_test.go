@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"video-subtitle-generator/services"
 )
 
 func TestHomeHandler(t *testing.T) {
@@ -71,3 +72,45 @@ func contains(s, substr string) bool {
 	return len(s) >= len(substr) && s[0:len(substr)] == substr || len(s) > len(substr) && contains(s[1:], substr)
 	// simple contains check, or use strings.Contains
 }
+
+func TestHomeHandlerLibrary(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "home_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	templatesDir := filepath.Join(tmpDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates dir: %v", err)
+	}
+	layoutContent := `{{define "layout.html"}}{{template "content" .}}{{end}}`
+	indexContent := `{{define "content"}}{{range .Library}}<li>{{.Media.ID}}:{{.State}}</li>{{end}}{{end}}`
+	if err := os.WriteFile(filepath.Join(templatesDir, "layout.html"), []byte(layoutContent), 0644); err != nil {
+		t.Fatalf("Failed to write layout.html: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templatesDir, "index.html"), []byte(indexContent), 0644); err != nil {
+		t.Fatalf("Failed to write index.html: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change wd: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	db := useTestStore(t)
+	addTranscribedMedia(t, db, "first", &services.Transcript{})
+	if err := db.CreateMedia(&services.Media{ID: "second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	HomeHandler(rr, httptest.NewRequest("GET", "/", nil))
+
+	// The untimed "second" sorts as oldest
+	expected := "<li>first:done</li><li>second:</li>"
+	if rr.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), expected)
+	}
+}
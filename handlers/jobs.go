@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"video-subtitle-generator/services"
+)
+
+// store keeps uploads, jobs and transcripts, and jobs is the queue
+// transcription requests go to. Both are nil until Start is called.
+var (
+	store *services.Store
+	jobs  *services.JobQueue
+)
+
+// Start connects the handlers to the database and starts the transcription
+// workers. main calls it once at startup, after setting UploadDir; the
+// returned queue should be closed on shutdown, before the store.
+func Start(db *services.Store, workers int) *services.JobQueue {
+	store = db
+	uploads = services.NewUploads(db, filepath.Join(UploadDir, "partial"))
+	jobs = services.NewJobQueue(db, workers, runTranscriptionJob)
+	return jobs
+}
+
+// JobHandler renders the current state of a job, e.g. GET /jobs/{id}. While
+// the job runs the fragment follows JobEventsHandler; once it is done it is
+// fetched again and replaced by the transcript.
+func JobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if jobs == nil {
+		http.Error(w, "Transcription queue is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	job, err := jobs.Get(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotFound) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to load job: %v", err)
+		http.Error(w, "Could not load job", http.StatusInternalServerError)
+		return
+	}
+
+	renderJob(w, job)
+}
+
+// progressHeartbeat is how often the event stream is refreshed when nothing
+// happens, so the ETA keeps moving and proxies don't drop the connection.
+const progressHeartbeat = 15 * time.Second
+
+// JobEventsHandler streams a job's progress as Server-Sent Events, e.g.
+// GET /jobs/{id}/events. Each "progress" event carries the rendered progress
+// fragment; a final "done" event tells the page to fetch the result.
+func JobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if jobs == nil {
+		http.Error(w, "Transcription queue is not running", http.StatusServiceUnavailable)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	id := r.PathValue("id")
+	// Subscribe before the first read so no update can slip in between
+	updates, unsubscribe := jobs.Subscribe(id)
+	defer unsubscribe()
+
+	if _, err := jobs.Get(id); err != nil {
+		if errors.Is(err, services.ErrJobNotFound) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to load job: %v", err)
+		http.Error(w, "Could not load job", http.StatusInternalServerError)
+		return
+	}
+
+	tmplPath := filepath.Join("templates", "job.html")
+	tmpl, err := template.New("job.html").Funcs(templateFuncs).ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(progressHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		job, err := jobs.Get(id)
+		if err != nil {
+			log.Printf("Failed to load job %s: %v", id, err)
+			return
+		}
+		if job.Finished() {
+			writeEvent(w, "done", string(job.State))
+			flusher.Flush()
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, "progress", job); err != nil {
+			log.Printf("Failed to render progress for job %s: %v", id, err)
+			return
+		}
+		writeEvent(w, "progress", buf.String())
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-updates:
+		case <-heartbeat.C:
+		}
+	}
+}
+
+// writeEvent writes one Server-Sent Event. Every line of data needs its own
+// "data:" field.
+func writeEvent(w io.Writer, event, data string) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+func renderJob(w http.ResponseWriter, job *services.Job) {
+	switch job.State {
+	case services.JobFailed:
+		escapedErr := html.EscapeString(job.Error)
+		w.Write([]byte("<div class='error'>" + escapedErr + "</div>"))
+	case services.JobDone:
+		renderTranscript(w, job)
+	default:
+		tmplPath := filepath.Join("templates", "job.html")
+		tmpl, err := template.New("job.html").Funcs(templateFuncs).ParseFiles(tmplPath)
+		if err != nil {
+			w.Write([]byte("<div class='error'>Template error</div>"))
+			return
+		}
+		tmpl.ExecuteTemplate(w, "job.html", job)
+	}
+}
+
+func renderTranscript(w http.ResponseWriter, job *services.Job) {
+	tmplPath := filepath.Join("templates", "transcript.html")
+	playerPath := filepath.Join("templates", "player.html")
+	tmpl, err := template.New("transcript.html").Funcs(templateFuncs).ParseFiles(tmplPath, playerPath)
+	if err != nil {
+		w.Write([]byte("<div class='error'>Template error</div>"))
+		return
+	}
+
+	data := map[string]interface{}{
+		"Transcript":    job.Transcript,
+		"TranscribedBy": job.TranscribedBy,
+		"Name":          job.MediaID,
+		"VideoPath":     videoURL(job.MediaID),
+		"SubtitlesURL":  subtitlesURL(job.MediaID, "vtt"),
+		"SubtitlesLang": subtitlesLang(job.Transcript),
+	}
+	if store != nil {
+		if media, err := store.GetMedia(job.MediaID); err == nil {
+			data["VideoType"] = videoType(media)
+		}
+	}
+	tmpl.ExecuteTemplate(w, "transcript.html", data)
+}
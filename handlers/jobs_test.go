@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"video-subtitle-generator/services"
+)
+
+func TestJobHandler(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "jobs_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	templatesDir := filepath.Join(tmpDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates dir: %v", err)
+	}
+	files := map[string]string{
+		"job.html":        `<div>State: {{.State.Label}}</div>`,
+		"transcript.html": `<div>Transcript: {{.Transcript.Text}}</div>`,
+		"player.html":     `{{define "video"}}{{end}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(templatesDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	originalWd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change wd: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	release := make(chan struct{})
+	run := func(ctx context.Context, job *services.Job, report *services.JobReporter) (*services.Transcript, error) {
+		report.SetState(services.JobTranscribing)
+		<-release
+		if job.VideoPath == "bad.mp4" {
+			return nil, errors.New("boom")
+		}
+		return &services.Transcript{Segments: []services.Segment{{Text: "Hello"}}}, nil
+	}
+	jobs = services.NewJobQueue(services.NewMemoryJobStore(), 2, run)
+	defer func() {
+		jobs.Close()
+		jobs = nil
+	}()
+
+	good, err := jobs.Submit(&services.Job{VideoPath: "good.mp4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := jobs.Submit(&services.Job{VideoPath: "bad.mp4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/jobs/"+id, nil)
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		JobHandler(rr, req)
+		return rr
+	}
+
+	// Wait until the worker has picked the job up
+	waitFor := func(id string, state services.JobState) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if job, _ := jobs.Get(id); job.State == state {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("Job %s never reached %s", id, state)
+	}
+
+	waitFor(good.ID, services.JobTranscribing)
+	if body := get(good.ID).Body.String(); !strings.Contains(body, "State: Transcribing") {
+		t.Errorf("Expected running state, got %q", body)
+	}
+
+	close(release)
+	waitFor(good.ID, services.JobDone)
+	waitFor(bad.ID, services.JobFailed)
+
+	if body := get(good.ID).Body.String(); !strings.Contains(body, "Transcript: Hello") {
+		t.Errorf("Expected transcript, got %q", body)
+	}
+	if body := get(bad.ID).Body.String(); !strings.Contains(body, "class='error'>boom") {
+		t.Errorf("Expected error, got %q", body)
+	}
+	if rr := get("missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown job, got %d", rr.Code)
+	}
+}
+
+func TestJobEventsHandler(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "job_events_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	templatesDir := filepath.Join(tmpDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates dir: %v", err)
+	}
+	jobContent := `{{define "progress"}}<p>{{.State.Label}}</p>
+<p>{{.Progress.Percent}}%</p>{{end}}`
+	if err := os.WriteFile(filepath.Join(templatesDir, "job.html"), []byte(jobContent), 0644); err != nil {
+		t.Fatalf("Failed to write job.html: %v", err)
+	}
+
+	originalWd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change wd: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	step := make(chan struct{})
+	run := func(ctx context.Context, job *services.Job, report *services.JobReporter) (*services.Transcript, error) {
+		report.SetState(services.JobExtracting)
+		<-step
+		report.Progress(30*time.Second, 60*time.Second)
+		<-step
+		return &services.Transcript{}, nil
+	}
+	jobs = services.NewJobQueue(services.NewMemoryJobStore(), 1, run)
+	defer func() {
+		jobs.Close()
+		jobs = nil
+	}()
+
+	job, err := jobs.Submit(&services.Job{VideoPath: "video.mp4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs/{id}/events", JobEventsHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %q", ct)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// readEvent returns the next event name and its joined data lines
+	readEvent := func() (string, string) {
+		var event string
+		var data []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				return event, strings.Join(data, "\n")
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = append(data, strings.TrimPrefix(line, "data: "))
+			}
+		}
+		t.Fatalf("Stream ended early: %v", scanner.Err())
+		return "", ""
+	}
+
+	// Skip events until the expected content shows up
+	expect := func(event, contains string) {
+		for i := 0; i < 10; i++ {
+			name, data := readEvent()
+			if name == event && strings.Contains(data, contains) {
+				return
+			}
+		}
+		t.Fatalf("Never saw %s event containing %q", event, contains)
+	}
+
+	expect("progress", "<p>Extracting audio</p>\n<p>0%</p>")
+	step <- struct{}{}
+	expect("progress", "<p>50%</p>")
+	step <- struct{}{}
+	expect("done", "done")
+}
+
+func TestFormatETA(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{42 * time.Second, "42s"},
+		{3*time.Minute + 20*time.Second, "3m"},
+		{time.Hour + 19*time.Minute + 40*time.Second, "1h 20m"},
+	}
+	for _, tt := range tests {
+		if got := formatETA(tt.d); got != tt.want {
+			t.Errorf("formatETA(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
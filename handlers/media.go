@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"video-subtitle-generator/services"
+)
+
+// videoURL is where the player streams a media item from.
+func videoURL(mediaID string) string {
+	return "/media/" + mediaID + "/video"
+}
+
+// videoType is the MIME type the player announces for a media item's video.
+// Uploads from before probing was added fall back to their extension.
+func videoType(media *services.Media) string {
+	if media.Info != nil {
+		return media.Info.MIMEType()
+	}
+	return mime.TypeByExtension(filepath.Ext(media.Filename))
+}
+
+// playerData is the template data for player.html. Only the media ID goes
+// to the client; the file's location stays on the server.
+func playerData(media *services.Media) map[string]interface{} {
+	backends := services.Transcribers()
+	chooseModel, chooseComputeType := false, false
+	for _, b := range backends {
+		if len(b.Capabilities().Models) > 0 {
+			chooseModel = true
+		}
+		if len(b.Capabilities().ComputeTypes) > 0 {
+			chooseComputeType = true
+		}
+	}
+	return map[string]interface{}{
+		"Name":           media.ID,
+		"MediaID":        media.ID,
+		"VideoPath":      videoURL(media.ID),
+		"VideoType":      videoType(media),
+		"Info":           media.Info,
+		"Backends":       backends,
+		"ChooseModel":    chooseModel,
+		"ChooseCompute":  chooseComputeType,
+		"Filters":        services.FilterPresets,
+		"DefaultBackend": DefaultBackend,
+		"AutoBackend":    Routes != nil,
+	}
+}
+
+// MediaHandler reopens a stored upload, e.g. GET /media/{id}. It renders
+// the player and swaps the transcript, or the running job, into the
+// transcript panel.
+func MediaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	media, transcript, err := loadTranscript(r.PathValue("id"))
+	if err != nil && !errors.Is(err, errNoTranscript) {
+		if errors.Is(err, services.ErrMediaNotFound) {
+			http.Error(w, "Video not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to load media: %v", err)
+		http.Error(w, "Could not load video", http.StatusInternalServerError)
+		return
+	}
+
+	data := playerData(media)
+	if transcript != nil {
+		data["Transcript"] = transcript
+		data["SubtitlesURL"] = subtitlesURL(media.ID, "vtt")
+		data["SubtitlesLang"] = subtitlesLang(transcript)
+	}
+	// A job still in progress is more interesting than an older transcript
+	if jobs != nil && media.JobID != "" && media.JobID != media.TranscriptJobID {
+		if job, err := jobs.Get(media.JobID); err == nil && !job.Finished() {
+			data["Job"] = job
+		}
+	}
+
+	tmpl, err := template.New("media.html").Funcs(templateFuncs).ParseFiles(
+		filepath.Join("templates", "media.html"),
+		filepath.Join("templates", "player.html"),
+		filepath.Join("templates", "transcript.html"),
+		filepath.Join("templates", "job.html"),
+	)
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "media.html", data)
+}
+
+// MediaVideoHandler streams the uploaded video of a media item, e.g.
+// GET /media/{id}/video. Range requests are supported so the player can seek.
+func MediaVideoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if store == nil {
+		http.Error(w, "Store is not open", http.StatusServiceUnavailable)
+		return
+	}
+
+	media, err := store.GetMedia(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrMediaNotFound) {
+			http.Error(w, "Video not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to load media: %v", err)
+		http.Error(w, "Could not load video", http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.Open(media.Path)
+	if err != nil {
+		log.Printf("Failed to open video for media %s: %v", media.ID, err)
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "Could not load video", http.StatusInternalServerError)
+		return
+	}
+	// Without a probed type, ServeContent goes by the stored filename's
+	// extension
+	if media.Info != nil {
+		w.Header().Set("Content-Type", media.Info.MIMEType())
+	}
+	http.ServeContent(w, r, media.Filename, info.ModTime(), file)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"video-subtitle-generator/services"
+)
+
+// useTestStore opens a throwaway store as the handlers' store until the test
+// ends.
+func useTestStore(t *testing.T) *services.Store {
+	t.Helper()
+	db, err := services.OpenStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	store = db
+	t.Cleanup(func() {
+		store = nil
+		db.Close()
+	})
+	return db
+}
+
+// addTranscribedMedia stores a media item whose latest job finished with
+// the given transcript.
+func addTranscribedMedia(t *testing.T, db *services.Store, id string, transcript *services.Transcript) {
+	t.Helper()
+	media := &services.Media{
+		ID:              id,
+		Filename:        id + ".mp4",
+		OriginalName:    "video.mp4",
+		CreatedAt:       time.Now(),
+		JobID:           "job-" + id,
+		TranscriptJobID: "job-" + id,
+	}
+	if err := db.CreateMedia(media); err != nil {
+		t.Fatalf("Failed to create media: %v", err)
+	}
+	job := &services.Job{ID: "job-" + id, MediaID: id, State: services.JobDone, Transcript: transcript}
+	if err := db.CreateJob(job); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+}
+
+func TestMediaHandler(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "media_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	templatesDir := filepath.Join(tmpDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates dir: %v", err)
+	}
+	files := map[string]string{
+		"media.html":      `{{template "player.html" .}}{{if .Transcript}}{{template "transcript" .}}{{end}}`,
+		"player.html":     `<div>Video: {{.VideoPath}} Track: {{.SubtitlesURL}}</div>`,
+		"transcript.html": `{{define "transcript"}}<div>Transcript: {{.Transcript.Text}}</div>{{end}}`,
+		"job.html":        `<div>Job</div>`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(templatesDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	originalWd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change wd: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	db := useTestStore(t)
+	addTranscribedMedia(t, db, "done", &services.Transcript{Segments: []services.Segment{{Text: "Hello again"}}})
+	if err := db.CreateMedia(&services.Media{ID: "fresh", Filename: "fresh.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	// A job was queued, but the queue isn't running
+	if err := db.CreateMedia(&services.Media{ID: "queued", Filename: "queued.mp4", JobID: "job-queued"}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/media/"+id, nil)
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		MediaHandler(rr, req)
+		return rr
+	}
+
+	body := get("done").Body.String()
+	if !strings.Contains(body, "Video: /media/done/video Track: /subtitles/done.vtt") {
+		t.Errorf("Expected player with captions track, got %q", body)
+	}
+	if !strings.Contains(body, "Transcript: Hello again") {
+		t.Errorf("Expected stored transcript, got %q", body)
+	}
+
+	body = get("fresh").Body.String()
+	if !strings.Contains(body, "Video: /media/fresh/video Track: </div>") || strings.Contains(body, "Transcript:") {
+		t.Errorf("Expected player without transcript, got %q", body)
+	}
+
+	if rr := get("queued"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Video: /media/queued/video") {
+		t.Errorf("Expected the player without a job queue, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := get("missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown media, got %d", rr.Code)
+	}
+}
+
+func TestMediaVideoHandler(t *testing.T) {
+	db := useTestStore(t)
+	videoPath := filepath.Join(t.TempDir(), "abc.mp4")
+	if err := os.WriteFile(videoPath, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateMedia(&services.Media{ID: "abc", Filename: "abc.mp4", Path: videoPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/media/abc/video", nil)
+	req.SetPathValue("id", "abc")
+	req.Header.Set("Range", "bytes=2-5")
+	rr := httptest.NewRecorder()
+	MediaVideoHandler(rr, req)
+
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("Expected 206 for a range request, got %d", rr.Code)
+	}
+	if rr.Body.String() != "2345" {
+		t.Errorf("Unexpected body %q", rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "video/mp4" {
+		t.Errorf("Expected video/mp4, got %q", ct)
+	}
+
+	req = httptest.NewRequest("GET", "/media/nope/video", nil)
+	req.SetPathValue("id", "nope")
+	rr = httptest.NewRecorder()
+	MediaVideoHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown media, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"video-subtitle-generator/services"
+)
+
+// UploadDir is where uploaded videos are stored. It is outside ./static so
+// videos are only reachable through their media ID. main sets it from the
+// server config.
+var UploadDir = "./data/uploads"
+
+// errNoTranscript is returned by loadTranscript for media that has not been
+// transcribed yet.
+var errNoTranscript = errors.New("no transcript")
+
+// loadTranscript returns the current transcript of a media item along with
+// the media itself.
+func loadTranscript(mediaID string) (*services.Media, *services.Transcript, error) {
+	if store == nil {
+		return nil, nil, errors.New("store is not open")
+	}
+	media, err := store.GetMedia(mediaID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if media.TranscriptJobID == "" {
+		return media, nil, errNoTranscript
+	}
+	job, err := store.GetJob(media.TranscriptJobID)
+	if err != nil {
+		return media, nil, err
+	}
+	if job.Transcript == nil {
+		return media, nil, errNoTranscript
+	}
+	return media, job.Transcript, nil
+}
+
+// SubtitlesHandler serves the subtitles of a transcribed video as SRT or
+// WebVTT by media ID, e.g. GET /subtitles/3f2a...e1.srt. The .vtt form is also
+// what the player's <track> loads.
+func SubtitlesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	ext := filepath.Ext(name)
+	id := strings.TrimSuffix(name, ext)
+	if id == "" {
+		http.Error(w, "Invalid subtitle name", http.StatusBadRequest)
+		return
+	}
+
+	var contentType string
+	var write func(*services.Transcript) error
+	switch ext {
+	case ".srt":
+		contentType = "application/x-subrip; charset=utf-8"
+		write = func(t *services.Transcript) error { return services.WriteSRT(w, t.Segments) }
+	case ".vtt":
+		contentType = "text/vtt; charset=utf-8"
+		write = func(t *services.Transcript) error {
+			return services.WriteVTT(w, t.Segments, services.VTTOptions{
+				Notes: []string{"Generated by Subtitle Generator"},
+			})
+		}
+	default:
+		http.Error(w, "Unsupported subtitle format", http.StatusNotFound)
+		return
+	}
+
+	media, transcript, err := loadTranscript(id)
+	if err != nil {
+		if errors.Is(err, services.ErrMediaNotFound) || errors.Is(err, errNoTranscript) {
+			http.Error(w, "Subtitles not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to load transcript %s: %v", id, err)
+		http.Error(w, "Could not load subtitles", http.StatusInternalServerError)
+		return
+	}
+
+	// Name the download after the original video rather than the ID
+	original := filepath.Base(media.OriginalName)
+	download := strings.TrimSuffix(original, filepath.Ext(original))
+	if download == "" || download == "." {
+		download = "subtitles"
+	}
+	download += ext
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": download}))
+	if err := write(transcript); err != nil {
+		log.Printf("Failed to write subtitles %s: %v", name, err)
+	}
+}
+
+// subtitlesURL is the public URL of a transcribed video's subtitles.
+func subtitlesURL(stem, format string) string {
+	return "/subtitles/" + stem + "." + format
+}
+
+// languageTagRe matches a BCP 47 language tag such as "en" or "pt-BR", as
+// srclang needs. Some backends name the language instead, e.g. "english".
+var languageTagRe = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// subtitlesLang is the srclang of the transcript's subtitles track. A
+// subtitles track must have one, so a language the backend didn't report as
+// a tag is "und", undetermined.
+func subtitlesLang(transcript *services.Transcript) string {
+	if transcript == nil || !languageTagRe.MatchString(transcript.Language) {
+		return "und"
+	}
+	return transcript.Language
+}
+
+// templateFuncs are the helpers available to templates that render segments.
+var templateFuncs = template.FuncMap{
+	"timestamp": func(d time.Duration) string {
+		// Drop the milliseconds; they are noise in the transcript view
+		return services.FormatTimestamp(d, ".")[:8]
+	},
+	"eta": formatETA,
+}
+
+// formatETA renders a rough remaining time such as "45s", "3m" or "1h 20m".
+func formatETA(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Round(time.Second).Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Round(time.Minute).Minutes()))
+	}
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+}
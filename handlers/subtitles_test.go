@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"video-subtitle-generator/services"
+)
+
+func TestSubtitlesHandler(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "subtitles_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	originalWd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change wd: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	db := useTestStore(t)
+	transcript := &services.Transcript{Segments: []services.Segment{
+		{Start: 0, End: 2 * time.Second, Text: "Hello world"},
+	}}
+	addTranscribedMedia(t, db, "123_video", transcript)
+	if err := db.CreateMedia(&services.Media{ID: "456_pending"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "SRT download",
+			file:       "123_video.srt",
+			wantStatus: http.StatusOK,
+			wantBody:   "1\n00:00:00,000 --> 00:00:02,000\nHello world\n",
+		},
+		{
+			name:       "VTT download",
+			file:       "123_video.vtt",
+			wantStatus: http.StatusOK,
+			wantBody:   "WEBVTT\n\nNOTE Generated by Subtitle Generator\n\n00:00:00.000 --> 00:00:02.000\nHello world\n",
+		},
+		{
+			name:       "Unknown video",
+			file:       "456_other.srt",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Not transcribed yet",
+			file:       "456_pending.vtt",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Unsupported format",
+			file:       "123_video.ass",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "Missing ID",
+			file:       ".srt",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/subtitles/"+tt.file, nil)
+			req.SetPathValue("name", tt.file)
+			rr := httptest.NewRecorder()
+
+			SubtitlesHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("handler returned unexpected body: %q", rr.Body.String())
+			}
+			// Downloads are named after the original video, not the ID
+			if tt.wantStatus == http.StatusOK && !strings.HasPrefix(rr.Header().Get("Content-Disposition"), "attachment; filename=video.") {
+				t.Errorf("Expected attachment Content-Disposition, got %q", rr.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
+
+func TestSubtitlesLang(t *testing.T) {
+	tests := []struct {
+		transcript *services.Transcript
+		want       string
+	}{
+		{&services.Transcript{Language: "de"}, "de"},
+		{&services.Transcript{Language: "pt-BR"}, "pt-BR"},
+		{&services.Transcript{Language: "english"}, "und"},
+		{&services.Transcript{}, "und"},
+		{nil, "und"},
+	}
+	for _, tt := range tests {
+		if got := subtitlesLang(tt.transcript); got != tt.want {
+			t.Errorf("subtitlesLang(%+v) = %q, want %q", tt.transcript, got, tt.want)
+		}
+	}
+}
@@ -1,125 +1,337 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"html"
-	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 	"video-subtitle-generator/services"
 )
 
-func validateVideoPath(videoPath string) error {
-	// 1. Basic empty check
-	if videoPath == "" {
-		return fmt.Errorf("video path is empty")
-	}
+// AudioCacheDir keeps extracted audio between jobs, so transcribing a video
+// again skips ffmpeg. main sets it from the server config; empty disables
+// the cache.
+var AudioCacheDir = ""
 
-	// 2. Prevent Argument Injection (starting with -)
-	if strings.HasPrefix(videoPath, "-") {
-		return fmt.Errorf("invalid filename")
-	}
+// DefaultBackend is the transcription backend used when a request does not
+// pick one. main sets it from the server config.
+var DefaultBackend = "local"
 
-	// 3. Path Traversal Check
-	// Clean the path to resolve .. and .
-	cleanPath := filepath.Clean(videoPath)
+// Routes pick the backends for each job and the order to fall back through.
+// main loads them from the server config; nil sends every job to the backend
+// it picked and offers no automatic choice.
+var Routes *services.Routes
 
-	// Get absolute path of the uploads directory
-	cwd, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("server error resolving paths")
+func TranscribeHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println("TranscribeHandler called")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	uploadsDir := filepath.Join(cwd, "static", "uploads")
 
-	// Resolve symlinks for uploadsDir to ensure we have the canonical path
-	absUploadsDir, err := filepath.EvalSymlinks(uploadsDir)
-	if err != nil {
-		// If the directory doesn't exist yet (might happen if no uploads yet),
-		// we can try Abs, but for security it's better if it exists.
-		// In this app, upload.go creates it.
-		// If it doesn't exist, we can't validate properly, so fail safe.
-		absUploadsDir, err = filepath.Abs(uploadsDir)
-		if err != nil {
-			return fmt.Errorf("server error resolving uploads path")
-		}
+	if jobs == nil || store == nil {
+		w.Write([]byte("<div class='error'>Error: transcription queue is not running</div>"))
+		return
 	}
 
-	// Get absolute path of the requested video
-	absVideoPath, err := filepath.Abs(cleanPath)
+	// The client only ever knows the opaque media ID; the file's path is
+	// looked up on the server
+	media, err := store.GetMedia(r.FormValue("mediaID"))
 	if err != nil {
-		return fmt.Errorf("invalid video path")
+		if !errors.Is(err, services.ErrMediaNotFound) {
+			log.Printf("Failed to load media: %v", err)
+		}
+		w.Write([]byte("<div class='error'>Error: video not found, please upload it again</div>"))
+		return
 	}
 
-	// Resolve symlinks for the video path as well
-	// This handles cases where the file path might contain symlinks
-	realVideoPath, err := filepath.EvalSymlinks(absVideoPath)
-	if err != nil {
-		// If file doesn't exist, EvalSymlinks fails.
-		// We check existence later, but for prefix check we need canonical path.
-		// If it fails, it likely doesn't exist or is invalid.
-		return fmt.Errorf("file not found or invalid path")
+	// Multi-track files transcribe one audio track at a time
+	audioStream := 0
+	if v := r.FormValue("audioStream"); v != "" {
+		audioStream, err = strconv.Atoi(v)
+		if err != nil || audioStream < 0 || (media.Info != nil && audioStream >= len(media.Info.Audio)) {
+			w.Write([]byte("<div class='error'>Error: unknown audio track</div>"))
+			return
+		}
 	}
 
-	// Check if realVideoPath starts with absUploadsDir
-	if !strings.HasPrefix(realVideoPath, absUploadsDir) {
-		return fmt.Errorf("access denied: file must be in uploads directory")
+	// The preset is copied into the job, so it reruns the same way
+	var filter *services.FilterPreset
+	if name := r.FormValue("filter"); name != "" {
+		preset, err := services.GetFilterPreset(name)
+		if err != nil {
+			escapedErr := html.EscapeString(err.Error())
+			w.Write([]byte("<div class='error'>Error: " + escapedErr + "</div>"))
+			return
+		}
+		filter = &preset
 	}
 
-	// Check if file actually exists (redundant if EvalSymlinks succeeded, but good for clarity)
-	if _, err := os.Stat(realVideoPath); err != nil {
-		return fmt.Errorf("file not found")
+	backend := r.FormValue("backend")
+	if backend == "" {
+		backend = DefaultBackend
 	}
-
-	return nil
-}
-
-func TranscribeHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("TranscribeHandler called")
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if backend == services.AutoBackend && Routes == nil {
+		w.Write([]byte("<div class='error'>Error: automatic backend choice is not configured</div>"))
 		return
 	}
+	if backend != services.AutoBackend {
+		if _, err := services.GetTranscriber(backend); err != nil {
+			escapedErr := html.EscapeString(err.Error())
+			w.Write([]byte("<div class='error'>Error: " + escapedErr + "</div>"))
+			return
+		}
+	}
 
-	videoPath := r.FormValue("videoPath") // This should be the local filesystem path
-
-	// Security Validation
-	if err := validateVideoPath(videoPath); err != nil {
-		log.Printf("Security alert: Invalid video path attempt: %s. Error: %v", videoPath, err)
-		// Escape the error message to prevent XSS
+	// The options are checked against the first backend routed to; the
+	// others are fallbacks that do what they can with them
+	var duration time.Duration
+	if media.Info != nil {
+		duration = media.Info.Duration
+	}
+	chain := Routes.Route(backend, strings.TrimSpace(r.FormValue("language")), duration)
+	transcriber, err := services.GetTranscriber(chain[0])
+	if err != nil {
 		escapedErr := html.EscapeString(err.Error())
 		w.Write([]byte("<div class='error'>Error: " + escapedErr + "</div>"))
 		return
 	}
 
-	// 1. Extract Audio
-	audioPath, err := services.ExtractAudio(videoPath)
+	opts, err := transcribeOptions(r, transcriber)
 	if err != nil {
 		escapedErr := html.EscapeString(err.Error())
-		w.Write([]byte("<div class='error'>Error extracting audio: " + escapedErr + "</div>"))
+		w.Write([]byte("<div class='error'>Error: " + escapedErr + "</div>"))
 		return
 	}
 
-	// 2. Transcribe (Local)
-	text, err := services.TranscribeAudioLocal(audioPath)
+	// Transcription can take minutes, so queue it and let the page follow
+	// its progress
+	job, err := jobs.Submit(&services.Job{
+		MediaID:     media.ID,
+		VideoPath:   media.Path,
+		AudioStream: audioStream,
+		SkipSilence: r.FormValue("skipSilence") != "",
+		AudioFilter: filter,
+		Backend:     backend,
+		Backends:    chain,
+		Options:     opts,
+	})
 	if err != nil {
 		escapedErr := html.EscapeString(err.Error())
-		w.Write([]byte("<div class='error'>Error transcribing: " + escapedErr + "</div>"))
+		w.Write([]byte("<div class='error'>Error: " + escapedErr + "</div>"))
 		return
 	}
+	if err := store.UpdateMedia(media.ID, func(m *services.Media) { m.JobID = job.ID }); err != nil {
+		log.Printf("Failed to link job %s to media %s: %v", job.ID, media.ID, err)
+	}
+
+	renderJob(w, job)
+}
+
+// maxBeamSize bounds the beam size a job can ask for; past it decoding only
+// gets slower.
+const maxBeamSize = 10
+
+// transcribeOptions reads the job's options from the form and checks the
+// backend supports them.
+func transcribeOptions(r *http.Request, transcriber services.Transcriber) (services.TranscribeOptions, error) {
+	opts := services.TranscribeOptions{
+		Language:    strings.TrimSpace(r.FormValue("language")),
+		Model:       r.FormValue("model"),
+		Prompt:      strings.TrimSpace(r.FormValue("prompt")),
+		ComputeType: r.FormValue("computeType"),
+	}
+	caps := transcriber.Capabilities()
+	if !caps.SupportsLanguage(opts.Language) {
+		return opts, fmt.Errorf("%s does not support language %q", transcriber.Description(), opts.Language)
+	}
+	if !caps.SupportsModel(opts.Model) {
+		return opts, fmt.Errorf("%s does not have the model %q", transcriber.Description(), opts.Model)
+	}
+	if !caps.SupportsComputeType(opts.ComputeType) {
+		return opts, fmt.Errorf("%s does not support compute type %q", transcriber.Description(), opts.ComputeType)
+	}
+	if v := strings.TrimSpace(r.FormValue("temperature")); v != "" {
+		temperature, err := strconv.ParseFloat(v, 64)
+		if err != nil || temperature < 0 || temperature > 1 {
+			return opts, fmt.Errorf("temperature must be a number from 0 to 1")
+		}
+		opts.Temperature = temperature
+	}
+	if v := strings.TrimSpace(r.FormValue("beamSize")); v != "" {
+		beamSize, err := strconv.Atoi(v)
+		if err != nil || beamSize < 1 || beamSize > maxBeamSize {
+			return opts, fmt.Errorf("beam size must be a number from 1 to %d", maxBeamSize)
+		}
+		opts.BeamSize = beamSize
+	}
+	return opts, nil
+}
+
+// runTranscriptionJob is the JobFunc behind the queue: extract the audio,
+// transcribe it with the job's backends, falling back to the next when one
+// fails. The queue stores the transcript with the job, which makes it the
+// media's current transcript.
+func runTranscriptionJob(ctx context.Context, job *services.Job, report *services.JobReporter) (*services.Transcript, error) {
+	chain := job.Backends
+	if len(chain) == 0 {
+		chain = []string{job.Backend}
+	}
+
+	// ffmpeg prints the duration while extracting, but cached audio skips
+	// it, so start from the length probed at upload
+	if store != nil {
+		if media, err := store.GetMedia(job.MediaID); err == nil && media.Info != nil {
+			report.SetDuration(media.Info.Duration)
+		}
+	}
+
+	var failures []string
+	for _, name := range chain {
+		transcriber, err := services.GetTranscriber(name)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		opts, ok := fallbackOptions(job.Options, transcriber.Capabilities())
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s: does not support language %q", name, opts.Language))
+			continue
+		}
+
+		transcript, err := transcribeWith(ctx, job, transcriber, opts, report)
+		if err == nil {
+			// The store points the subtitle downloads at this job once the
+			// queue saves it as done
+			report.SetTranscribedBy(name)
+			return transcript, nil
+		}
+		if ctx.Err() != nil || len(chain) == 1 {
+			return nil, err
+		}
+		log.Printf("Job %s: %s failed, trying the next backend: %v", job.ID, name, err)
+		failures = append(failures, name+": "+err.Error())
+	}
+	return nil, fmt.Errorf("every backend failed: %s", strings.Join(failures, "; "))
+}
 
-	// 3. Render Transcript
-	tmplPath := filepath.Join("templates", "transcript.html")
-	tmpl, err := template.ParseFiles(tmplPath)
+// fallbackOptions adapts the job's options to a backend. A model or compute
+// type it lacks, picked for another backend, gives way to its default; a
+// language it lacks rules it out.
+func fallbackOptions(opts services.TranscribeOptions, caps services.Capabilities) (services.TranscribeOptions, bool) {
+	if !caps.SupportsModel(opts.Model) {
+		opts.Model = ""
+	}
+	if !caps.SupportsComputeType(opts.ComputeType) {
+		opts.ComputeType = ""
+	}
+	return opts, caps.SupportsLanguage(opts.Language)
+}
+
+// transcribeWith runs one backend over the job's audio.
+func transcribeWith(ctx context.Context, job *services.Job, transcriber services.Transcriber, opts services.TranscribeOptions, report *services.JobReporter) (*services.Transcript, error) {
+	// 1. Extract Audio. Speech is found in PCM, so skipping silence
+	// extracts WAV and converts what is left for the backend afterwards.
+	// Each backend's format is cached, so falling back doesn't extract
+	// the same audio twice.
+	report.SetState(services.JobExtracting)
+	profile := transcriber.Capabilities().Audio
+	extract := services.ExtractOptions{
+		Stream:   job.AudioStream,
+		Profile:  profile,
+		CacheDir: AudioCacheDir,
+		Progress: report.Progress,
+	}
+	if job.AudioFilter != nil {
+		extract.Filters = job.AudioFilter.Filters
+	}
+	if job.SkipSilence {
+		extract.Profile = services.ProfileWAV
+	}
+	audioPath, err := services.ExtractAudioWithOptions(ctx, job.VideoPath, extract)
 	if err != nil {
-		w.Write([]byte("<div class='error'>Template error</div>"))
-		return
+		log.Printf("Job %s: extracting audio failed: %v", job.ID, err)
+		return nil, errors.New("error extracting audio: ffmpeg failed, the server log has the details")
+	}
+
+	var speech services.SpeechMap
+	transcript := &services.Transcript{}
+	if job.SkipSilence {
+		dir, err := os.MkdirTemp("", "speech-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		audioPath, speech, err = speechOnly(ctx, audioPath, dir, profile)
+		if errors.Is(err, services.ErrNoSpeech) {
+			audioPath = ""
+		} else if err != nil {
+			log.Printf("Job %s: removing silence failed: %v", job.ID, err)
+			return nil, errors.New("error removing silence, the server log has the details")
+		}
+	}
+
+	// 2. Transcribe. Progress and timestamps are in the audio's own time,
+	// which after removing silence is shorter than the video.
+	if audioPath != "" {
+		report.SetState(services.JobTranscribing)
+		opts.Progress = func(position time.Duration) { report.Progress(speech.Original(position), 0) }
+		transcript, err = transcriber.Transcribe(ctx, audioPath, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error transcribing: %s", describeTranscribeError(job, transcriber.Name(), err))
+		}
+		speech.Apply(transcript)
 	}
+	return transcript, nil
+}
+
+// apiErrorMessages explain API failures in terms of what the user can do
+// about them. %s is the backend's name.
+var apiErrorMessages = []struct {
+	err error
+	msg string
+}{
+	{services.ErrAPIAuth, "the API key was rejected, check the key configured for %s"},
+	{services.ErrAPIQuota, "the %s account has run out of quota, check its billing"},
+	{services.ErrAPIRateLimited, "%s is rate limiting requests, try again in a few minutes"},
+	{services.ErrAPITooLarge, "the audio is too large for %s, try another backend"},
+	{services.ErrAPIServer, "%s is having problems, try again later"},
+}
 
-	data := map[string]string{
-		"Transcript": text,
+// describeTranscribeError is the message a failed job shows for backend's
+// error. API failures get advice; the details, which may hold server paths
+// and the tool's output, only go to the log.
+func describeTranscribeError(job *services.Job, backend string, err error) string {
+	log.Printf("Job %s: %s failed: %v", job.ID, backend, err)
+	for _, m := range apiErrorMessages {
+		if errors.Is(err, m.err) {
+			return fmt.Sprintf(m.msg, backend)
+		}
+	}
+	return fmt.Sprintf("%s failed, the server log has the details", backend)
+}
+
+// speechOnly writes the speech in wavPath to dir, in the backend's audio
+// profile, and returns it with the map back to the original timeline.
+func speechOnly(ctx context.Context, wavPath, dir string, profile services.AudioProfile) (string, services.SpeechMap, error) {
+	speechPath := filepath.Join(dir, "speech.wav")
+	speech, err := services.RemoveSilence(wavPath, speechPath, services.VADOptions{})
+	if err != nil {
+		return "", nil, err
+	}
+	if profile.Name == "" || profile.Name == services.ProfileWAV.Name {
+		return speechPath, speech, nil
+	}
+	converted, err := services.ExtractAudioWithOptions(ctx, speechPath, services.ExtractOptions{Profile: profile})
+	if err != nil {
+		return "", nil, err
 	}
-	tmpl.Execute(w, data)
+	return converted, speech, nil
 }
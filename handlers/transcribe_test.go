@@ -1,91 +1,575 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"video-subtitle-generator/services"
 )
 
-func TestValidateVideoPath(t *testing.T) {
-	// Setup: Create a temporary directory structure mimicking the app
-	// We need a "static/uploads" directory in the current working directory for the test
-	// But we don't want to mess up the actual project.
-	// So we will change the CWD for the test.
+type stubTranscriber struct{}
 
-	tmpDir, err := os.MkdirTemp("", "test_app")
+func (stubTranscriber) Name() string                        { return "handlers-stub" }
+func (stubTranscriber) Description() string                 { return "Stub" }
+func (stubTranscriber) Capabilities() services.Capabilities { return services.Capabilities{} }
+
+func (stubTranscriber) Transcribe(ctx context.Context, audioPath string, opts services.TranscribeOptions) (*services.Transcript, error) {
+	return &services.Transcript{}, nil
+}
+
+// failingTranscriber is a backend whose tool is missing.
+type failingTranscriber struct{ stubTranscriber }
+
+func (failingTranscriber) Name() string { return "handlers-failing" }
+
+func (failingTranscriber) Transcribe(ctx context.Context, audioPath string, opts services.TranscribeOptions) (*services.Transcript, error) {
+	return nil, errors.New("whisper CLI tool not found")
+}
+
+var registerStubOnce sync.Once
+
+// registerStubTranscriber makes "handlers-stub" and "handlers-failing"
+// available; the registry is global and has no unregister, so it is only
+// done once per test binary.
+func registerStubTranscriber() {
+	registerStubOnce.Do(func() {
+		services.RegisterTranscriber(stubTranscriber{})
+		services.RegisterTranscriber(failingTranscriber{})
+	})
+}
+
+func TestTranscribeHandler(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "transcribe_test")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
-	// Create static/uploads inside tmpDir
-	uploadsDir := filepath.Join(tmpDir, "static", "uploads")
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		t.Fatalf("Failed to create uploads dir: %v", err)
+	templatesDir := filepath.Join(tmpDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates dir: %v", err)
 	}
-
-	// Create a valid video file
-	validVideoPath := filepath.Join(uploadsDir, "valid_video.mp4")
-	if err := os.WriteFile(validVideoPath, []byte("dummy content"), 0644); err != nil {
-		t.Fatalf("Failed to create dummy video file: %v", err)
+	jobContent := `<div>Job {{.State}} {{.Backend}}</div>`
+	if err := os.WriteFile(filepath.Join(templatesDir, "job.html"), []byte(jobContent), 0644); err != nil {
+		t.Fatalf("Failed to write job.html: %v", err)
 	}
 
-	// Create a file outside uploads
+	// A file outside the uploads that a client might try to name directly
 	outsideFile := filepath.Join(tmpDir, "outside.txt")
 	if err := os.WriteFile(outsideFile, []byte("secret"), 0644); err != nil {
 		t.Fatalf("Failed to create outside file: %v", err)
 	}
 
-	// Change CWD to tmpDir so the handler logic works as expected
 	originalWd, _ := os.Getwd()
 	if err := os.Chdir(tmpDir); err != nil {
 		t.Fatalf("Failed to change wd: %v", err)
 	}
 	defer os.Chdir(originalWd)
 
+	registerStubTranscriber()
+	db := useTestStore(t)
+	if err := db.CreateMedia(&services.Media{ID: "abc123", Path: "video.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	multiTrack := &services.Media{ID: "multi", Path: "dual.mkv", Info: &services.MediaInfo{
+		Container: "matroska,webm",
+		Audio:     []services.AudioStream{{Index: 1, Language: "eng"}, {Index: 2, Language: "deu"}},
+	}}
+	if err := db.CreateMedia(multiTrack); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateMedia(&services.Media{ID: "field", Path: "field.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs are only queued here; block them so the rendered state is stable
+	release := make(chan struct{})
+	jobs = services.NewJobQueue(db, 1, func(ctx context.Context, job *services.Job, report *services.JobReporter) (*services.Transcript, error) {
+		<-release
+		return &services.Transcript{}, nil
+	})
+	defer func() {
+		close(release)
+		jobs.Close()
+		jobs = nil
+	}()
+
 	tests := []struct {
-		name      string
-		videoPath string
-		wantErr   bool
+		name        string
+		mediaID     string
+		backend     string
+		audioStream string
+		filter      string
+		model       string
+		temperature string
+		computeType string
+		beamSize    string
+		wantBody    string
 	}{
 		{
-			name:      "Valid path",
-			videoPath: "./static/uploads/valid_video.mp4",
-			wantErr:   false,
+			name:     "Valid media",
+			mediaID:  "abc123",
+			backend:  "handlers-stub",
+			wantBody: "Job queued handlers-stub",
+		},
+		{
+			name:        "Second audio track",
+			mediaID:     "multi",
+			backend:     "handlers-stub",
+			audioStream: "1",
+			wantBody:    "Job queued handlers-stub",
 		},
 		{
-			name:      "Valid absolute path",
-			videoPath: validVideoPath,
-			wantErr:   false,
+			name:        "Audio track out of range",
+			mediaID:     "multi",
+			backend:     "handlers-stub",
+			audioStream: "2",
+			wantBody:    "unknown audio track",
 		},
 		{
-			name:      "Path traversal attempt",
-			videoPath: "./static/uploads/../../outside.txt",
-			wantErr:   true,
+			name:        "Audio track not a number",
+			mediaID:     "multi",
+			backend:     "handlers-stub",
+			audioStream: "eng",
+			wantBody:    "unknown audio track",
 		},
 		{
-			name:      "Argument injection attempt",
-			videoPath: "-option",
-			wantErr:   true,
+			name:     "Filter preset",
+			mediaID:  "field",
+			backend:  "handlers-stub",
+			filter:   "denoise",
+			wantBody: "Job queued handlers-stub",
 		},
 		{
-			name:      "Non-existent file",
-			videoPath: "./static/uploads/non_existent.mp4",
-			wantErr:   true,
+			name:     "Unknown filter preset",
+			mediaID:  "abc123",
+			backend:  "handlers-stub",
+			filter:   "louder",
+			wantBody: "unknown audio filter",
 		},
 		{
-			name:      "Empty path",
-			videoPath: "",
-			wantErr:   true,
+			name:     "Model the backend lacks",
+			mediaID:  "abc123",
+			backend:  "handlers-stub",
+			model:    "whisper-1",
+			wantBody: "does not have the model",
+		},
+		{
+			name:        "Temperature out of range",
+			mediaID:     "abc123",
+			backend:     "handlers-stub",
+			temperature: "1.5",
+			wantBody:    "temperature must be a number from 0 to 1",
+		},
+		{
+			name:        "Compute type the backend lacks",
+			mediaID:     "abc123",
+			backend:     "handlers-stub",
+			computeType: "int8",
+			wantBody:    "does not support compute type",
+		},
+		{
+			name:     "Beam size",
+			mediaID:  "abc123",
+			backend:  "handlers-stub",
+			beamSize: "5",
+			wantBody: "Job queued handlers-stub",
+		},
+		{
+			name:     "Beam size out of range",
+			mediaID:  "abc123",
+			backend:  "handlers-stub",
+			beamSize: "0",
+			wantBody: "beam size must be a number from 1 to 10",
+		},
+		{
+			name:     "Unknown backend",
+			mediaID:  "abc123",
+			backend:  "does-not-exist",
+			wantBody: "unknown transcription backend",
+		},
+		{
+			name:     "Automatic without routes",
+			mediaID:  "abc123",
+			backend:  services.AutoBackend,
+			wantBody: "automatic backend choice is not configured",
+		},
+		{
+			name:     "Unknown media",
+			mediaID:  "def456",
+			backend:  "handlers-stub",
+			wantBody: "video not found",
+		},
+		{
+			name:     "Raw path",
+			mediaID:  outsideFile,
+			backend:  "handlers-stub",
+			wantBody: "video not found",
+		},
+		{
+			name:     "Path traversal attempt",
+			mediaID:  "../../outside.txt",
+			backend:  "handlers-stub",
+			wantBody: "video not found",
+		},
+		{
+			name:     "Argument injection attempt",
+			mediaID:  "-option",
+			backend:  "handlers-stub",
+			wantBody: "video not found",
+		},
+		{
+			name:     "Empty ID",
+			mediaID:  "",
+			backend:  "handlers-stub",
+			wantBody: "video not found",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateVideoPath(tt.videoPath)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("validateVideoPath() error = %v, wantErr %v", err, tt.wantErr)
+			form := url.Values{
+				"mediaID":     {tt.mediaID},
+				"backend":     {tt.backend},
+				"audioStream": {tt.audioStream},
+				"filter":      {tt.filter},
+				"model":       {tt.model},
+				"temperature": {tt.temperature},
+				"computeType": {tt.computeType},
+				"beamSize":    {tt.beamSize},
+			}
+			req := httptest.NewRequest("POST", "/transcribe", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+
+			TranscribeHandler(rr, req)
+
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body containing %q, got %q", tt.wantBody, rr.Body.String())
 			}
 		})
 	}
+
+	// The queued job is linked to the media so it can be reopened
+	media, err := db.GetMedia("abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media.JobID == "" {
+		t.Error("Expected the media to reference its job")
+	}
+
+	// The chosen track is recorded on the job
+	media, err = db.GetMedia("multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := db.GetJob(media.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.AudioStream != 1 || job.VideoPath != "dual.mkv" {
+		t.Errorf("Expected a job for track 1 of dual.mkv, got %+v", job)
+	}
+
+	// So is a copy of the filter preset
+	media, err = db.GetMedia("field")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = db.GetJob(media.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.AudioFilter == nil || job.AudioFilter.Name != "denoise" || len(job.AudioFilter.Filters) == 0 {
+		t.Errorf("Expected the denoise preset on the job, got %+v", job.AudioFilter)
+	}
+
+	// Automatic jobs record the chain the routes picked
+	Routes = &services.Routes{Fallback: []string{"handlers-failing", "handlers-stub"}}
+	defer func() { Routes = nil }()
+	form := url.Values{"mediaID": {"abc123"}, "backend": {services.AutoBackend}}
+	req := httptest.NewRequest("POST", "/transcribe", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	TranscribeHandler(rr, req)
+	if !strings.Contains(rr.Body.String(), "Job queued auto") {
+		t.Fatalf("Expected an automatic job, got %q", rr.Body.String())
+	}
+	media, err = db.GetMedia("abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = db.GetJob(media.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(job.Backends, []string{"handlers-failing", "handlers-stub"}) {
+		t.Errorf("Expected the fallback chain on the job, got %v", job.Backends)
+	}
+}
+
+// useCachedAudio writes a video whose WAV audio is already in the audio
+// cache, so jobs for it need no ffmpeg, and returns the video's path.
+func useCachedAudio(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	video := filepath.Join(dir, "video.mp4")
+	if err := os.WriteFile(video, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	AudioCacheDir = filepath.Join(dir, "cache")
+	t.Cleanup(func() { AudioCacheDir = "" })
+	sum := sha256.Sum256([]byte("video"))
+	cached := filepath.Join(AudioCacheDir, hex.EncodeToString(sum[:])+".track0.wav16k.wav")
+	if err := os.MkdirAll(AudioCacheDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cached, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
+
+func TestRunTranscriptionJobFallback(t *testing.T) {
+	registerStubTranscriber()
+	db := useTestStore(t)
+	video := useCachedAudio(t)
+	if err := db.CreateMedia(&services.Media{ID: "fallback", Path: video}); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs = services.NewJobQueue(db, 1, runTranscriptionJob)
+	defer func() {
+		jobs.Close()
+		jobs = nil
+	}()
+
+	tests := []struct {
+		name     string
+		backends []string
+		want     services.JobState
+		wantBy   string
+		wantErr  string
+	}{
+		{"Falls back", []string{"handlers-failing", "handlers-stub"}, services.JobDone, "handlers-stub", ""},
+		{"Single backend", []string{"handlers-failing"}, services.JobFailed, "", "error transcribing: handlers-failing failed, the server log has the details"},
+		{"All fail", []string{"handlers-failing", "gone"}, services.JobFailed, "",
+			`every backend failed: handlers-failing: error transcribing: handlers-failing failed, the server log has the details; unknown transcription backend "gone"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job, err := jobs.Submit(&services.Job{MediaID: "fallback", VideoPath: video, Backend: services.AutoBackend, Backends: tt.backends})
+			if err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for !job.Finished() {
+				if time.Now().After(deadline) {
+					t.Fatalf("Job %s did not finish in time", job.ID)
+				}
+				time.Sleep(5 * time.Millisecond)
+				if job, err = jobs.Get(job.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if job.State != tt.want || job.TranscribedBy != tt.wantBy || job.Error != tt.wantErr {
+				t.Errorf("Expected %s by %s with error %q, got %s by %s with error %q",
+					tt.want, tt.wantBy, tt.wantErr, job.State, job.TranscribedBy, job.Error)
+			}
+		})
+	}
+}
+
+// pausingTranscriber reports progress without a duration, as whisper does,
+// then waits to be released.
+type pausingTranscriber struct {
+	stubTranscriber
+	reported, release chan struct{}
+}
+
+func (*pausingTranscriber) Name() string { return "handlers-pausing" }
+
+func (p *pausingTranscriber) Transcribe(ctx context.Context, audioPath string, opts services.TranscribeOptions) (*services.Transcript, error) {
+	opts.Progress(50 * time.Second)
+	close(p.reported)
+	<-p.release
+	return &services.Transcript{}, nil
+}
+
+var (
+	testPausing         = &pausingTranscriber{}
+	registerPausingOnce sync.Once
+)
+
+func TestRunTranscriptionJobSeedsDuration(t *testing.T) {
+	registerPausingOnce.Do(func() { services.RegisterTranscriber(testPausing) })
+	pausing := testPausing
+	pausing.reported, pausing.release = make(chan struct{}), make(chan struct{})
+	db := useTestStore(t)
+	// The audio is cached, so ffmpeg never reports the duration
+	video := useCachedAudio(t)
+	media := &services.Media{ID: "seeded", Path: video, Info: &services.MediaInfo{Duration: 100 * time.Second}}
+	if err := db.CreateMedia(media); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs = services.NewJobQueue(db, 1, runTranscriptionJob)
+	defer func() {
+		jobs.Close()
+		jobs = nil
+	}()
+	job, err := jobs.Submit(&services.Job{MediaID: "seeded", VideoPath: video, Backend: "handlers-pausing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(pausing.release)
+
+	select {
+	case <-pausing.reported:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Job did not start transcribing in time")
+	}
+	got, err := jobs.Get(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Progress.Position != 50*time.Second || got.Progress.Duration != 100*time.Second || got.Progress.ETA <= 0 {
+		t.Errorf("Expected progress against the probed duration, got %+v", got.Progress)
+	}
+}
+
+// testFake is the fake backend as main registers it; tests reconfigure it
+// between jobs.
+var (
+	testFake         = &services.Fake{}
+	registerFakeOnce sync.Once
+)
+
+func TestFakeTranscriberJobs(t *testing.T) {
+	tmpDir := t.TempDir()
+	templatesDir := filepath.Join(tmpDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates dir: %v", err)
+	}
+	files := map[string]string{
+		"job.html":        `{{define "progress"}}{{.State.Label}} at {{.Progress.Position}}{{end}}<div>{{template "progress" .}}</div>`,
+		"transcript.html": `<div>Transcript by {{.TranscribedBy}}: {{.Transcript.Text}}</div>`,
+		"player.html":     `{{define "video"}}{{end}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(templatesDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	originalWd, _ := os.Getwd()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change wd: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	registerFakeOnce.Do(func() { services.RegisterTranscriber(testFake) })
+	db := useTestStore(t)
+	video := useCachedAudio(t)
+	if err := db.CreateMedia(&services.Media{ID: "faked", Path: video}); err != nil {
+		t.Fatal(err)
+	}
+	jobs = services.NewJobQueue(db, 1, runTranscriptionJob)
+	defer func() {
+		jobs.Close()
+		jobs = nil
+	}()
+
+	// run submits a job for the fake backend and renders it until it
+	// finishes. It returns the final fragment and whether a fragment showed
+	// the job part way through transcribing.
+	run := func(t *testing.T) (string, bool) {
+		form := url.Values{"mediaID": {"faked"}, "backend": {"fake"}}
+		req := httptest.NewRequest("POST", "/transcribe", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		TranscribeHandler(httptest.NewRecorder(), req)
+		media, err := db.GetMedia("faked")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var midway bool
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			req := httptest.NewRequest("GET", "/jobs/"+media.JobID, nil)
+			req.SetPathValue("id", media.JobID)
+			rr := httptest.NewRecorder()
+			JobHandler(rr, req)
+			body := rr.Body.String()
+			if !strings.Contains(body, " at ") {
+				return body, midway
+			}
+			if strings.Contains(body, "Transcribing at ") && !strings.Contains(body, "Transcribing at 0s") {
+				midway = true
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+		t.Fatalf("Job %s did not finish in time", media.JobID)
+		return "", false
+	}
+
+	script := &services.Transcript{Segments: []services.Segment{{Start: time.Second, End: 2 * time.Second, Text: "Hallo Welt"}}}
+	tests := []struct {
+		name       string
+		script     *services.Transcript
+		latency    time.Duration
+		failure    string
+		failEvery  int
+		wantBodies []string
+	}{
+		{"Script", script, 200 * time.Millisecond, "", 0, []string{"Transcript by fake: Hallo Welt"}},
+		{"Failure", nil, 200 * time.Millisecond, "quota", 0,
+			[]string{"class='error'>error transcribing: the fake account has run out of quota, check its billing"}},
+		{"Every second job fails", nil, 0, "error", 2, []string{
+			"Transcript by fake: This is fake segment number 1.",
+			"class='error'>error transcribing: fake failed, the server log has the details",
+			"Transcript by fake: This is fake segment number 1.",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*testFake = services.Fake{Script: tt.script, Latency: tt.latency, Failure: tt.failure, FailEvery: tt.failEvery}
+			for i, want := range tt.wantBodies {
+				body, midway := run(t)
+				if !strings.Contains(body, want) {
+					t.Errorf("Job %d: expected %q, got %q", i+1, want, body)
+				}
+				if tt.latency > 0 && !midway {
+					t.Errorf("Job %d: expected progress to be shown while transcribing", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestDescribeTranscribeError(t *testing.T) {
+	job := &services.Job{ID: "job1", Backend: services.AutoBackend}
+	apiErr := &services.APIError{Status: 401, Message: "Incorrect API key provided", Kind: services.ErrAPIAuth}
+	// Chunked transcription wraps the chunk's error
+	wrapped := fmt.Errorf("chunk 2 of 3: %w", apiErr)
+	if got := describeTranscribeError(job, "team", wrapped); !strings.Contains(got, "key configured for team") {
+		t.Errorf("Expected advice about the API key, got %q", got)
+	}
+
+	// Tool output and server paths stay in the log
+	other := errors.New("whisper command failed: exit status 1\nOutput: /srv/data/cache/audio/abc.wav: No such file")
+	if got := describeTranscribeError(job, "local", other); got != "local failed, the server log has the details" {
+		t.Errorf("Expected other errors to be hidden, got %q", got)
+	}
 }
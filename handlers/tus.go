@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"video-subtitle-generator/services"
+)
+
+// Resumable uploads follow the tus protocol (https://tus.io/protocols/resumable-upload),
+// core plus the creation, expiration and termination extensions. A client
+// creates an upload with POST /uploads, sends the file in chunks with PATCH
+// /uploads/{id} and after a disconnect asks for the offset to resume from
+// with HEAD /uploads/{id}. The media ID of the finished video is the upload
+// ID.
+const tusVersion = "1.0.0"
+
+// MaxResumableUploadSize is the largest file TusHandler accepts. It is far
+// above MaxUploadSize, since resumable uploads are meant for long recordings.
+var MaxResumableUploadSize int64 = 20 << 30
+
+// UploadExpiry is how long an unfinished resumable upload is kept without
+// receiving data. main sets it from the server config.
+var UploadExpiry = 24 * time.Hour
+
+// uploads assembles resumable uploads. It is nil until Start is called.
+var uploads *services.Uploads
+
+// ExpireUploads removes resumable uploads that have gone stale. main calls
+// it periodically.
+func ExpireUploads() {
+	if uploads == nil {
+		return
+	}
+	n, err := uploads.Expire(UploadExpiry)
+	if err != nil {
+		log.Printf("Failed to expire uploads: %v", err)
+	}
+	if n > 0 {
+		log.Printf("Removed %d expired uploads", n)
+	}
+}
+
+// TusHandler announces the server's tus support and creates uploads, e.g.
+// OPTIONS /uploads and POST /uploads.
+func TusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,expiration,termination")
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(MaxResumableUploadSize, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkTusVersion(w, r) {
+		return
+	}
+	if uploads == nil {
+		http.Error(w, "Store is not open", http.StatusServiceUnavailable)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Upload-Length must be a positive number of bytes", http.StatusBadRequest)
+		return
+	}
+	if length > MaxResumableUploadSize {
+		http.Error(w, "File is too large, the limit is "+formatSize(MaxResumableUploadSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	filename := filepath.Base(parseTusMetadata(r.Header.Get("Upload-Metadata"))["filename"])
+	if filename == "." || filename == "/" {
+		filename = "video"
+	}
+
+	upload, err := uploads.Create(filename, length)
+	if err != nil {
+		log.Printf("Failed to create upload: %v", err)
+		http.Error(w, "Could not create upload", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/uploads/"+upload.ID)
+	setUploadExpires(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusUploadHandler reports, receives and terminates a single upload, e.g.
+// HEAD, PATCH and DELETE /uploads/{id}. The PATCH that delivers the last
+// byte stores the video as media.
+func TusUploadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method != http.MethodHead && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkTusVersion(w, r) {
+		return
+	}
+	if uploads == nil || store == nil {
+		http.Error(w, "Store is not open", http.StatusServiceUnavailable)
+		return
+	}
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodHead:
+		upload, err := uploads.Get(id)
+		if err != nil {
+			tusError(w, err)
+			return
+		}
+		// Offsets change with every chunk, so they must never be cached
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		setUploadExpires(w, upload)
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		if err := uploads.Delete(id); err != nil {
+			tusError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPatch:
+		if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+			http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "Upload-Offset must be a number of bytes", http.StatusBadRequest)
+			return
+		}
+
+		upload, err := uploads.Append(id, offset, r.Body)
+		if err != nil {
+			// If the connection dropped mid-chunk, what arrived is kept and
+			// the client resumes from the offset HEAD reports
+			tusError(w, err)
+			return
+		}
+
+		if upload.Complete() {
+			if _, err := finishUpload(upload); err != nil {
+				var rejected *uploadRejected
+				if errors.As(err, &rejected) {
+					http.Error(w, rejected.msg, rejected.status)
+					return
+				}
+				log.Printf("Failed to finish upload %s: %v", id, err)
+				http.Error(w, "Error saving file", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		setUploadExpires(w, upload)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// finishUpload moves a complete upload into the uploads dir, checks it can be
+// transcribed and records it as media under the upload's ID.
+func finishUpload(upload *services.Upload) (*services.Media, error) {
+	if err := os.MkdirAll(UploadDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	filePath := filepath.Join(UploadDir, mediaFilename(upload.ID, upload.Filename))
+	if err := uploads.Finish(upload.ID, filePath); err != nil {
+		return nil, err
+	}
+	info, err := probeUpload(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return createMedia(upload.ID, upload.Filename, filePath, upload.Length, info)
+}
+
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+func tusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrUploadNotFound):
+		// Expired uploads are gone for good; the client has to start over
+		http.Error(w, "Upload not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrUploadOffset):
+		http.Error(w, "Upload-Offset does not match the upload", http.StatusConflict)
+	case errors.Is(err, services.ErrUploadBusy):
+		http.Error(w, "Upload is already receiving data", http.StatusLocked)
+	default:
+		log.Printf("Upload failed: %v", err)
+		http.Error(w, "Upload failed", http.StatusInternalServerError)
+	}
+}
+
+func setUploadExpires(w http.ResponseWriter, upload *services.Upload) {
+	w.Header().Set("Upload-Expires", upload.UpdatedAt.Add(UploadExpiry).UTC().Format(http.TimeFormat))
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated
+// pairs of a key and a base64 value. Malformed pairs are skipped.
+func parseTusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		meta[key] = string(decoded)
+	}
+	return meta
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"video-subtitle-generator/services"
+)
+
+// useTestUploads points the handlers at a throwaway store and uploads dir
+// until the test ends.
+func useTestUploads(t *testing.T) *services.Store {
+	t.Helper()
+	db := useTestStore(t)
+	originalDir := UploadDir
+	UploadDir = filepath.Join(t.TempDir(), "uploads")
+	uploads = services.NewUploads(db, filepath.Join(UploadDir, "partial"))
+	t.Cleanup(func() {
+		UploadDir = originalDir
+		uploads = nil
+	})
+	return db
+}
+
+func tusRequest(method, target string, headers map[string]string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if id, ok := strings.CutPrefix(target, "/uploads/"); ok {
+		req.SetPathValue("id", id)
+	}
+	return req
+}
+
+func serveTus(req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	if req.PathValue("id") != "" {
+		TusUploadHandler(rr, req)
+	} else {
+		TusHandler(rr, req)
+	}
+	return rr
+}
+
+func TestTusUpload(t *testing.T) {
+	db := useTestUploads(t)
+	stubProbe(t, testMediaInfo, nil)
+
+	rr := serveTus(httptest.NewRequest("OPTIONS", "/uploads", nil))
+	if rr.Code != http.StatusNoContent || !strings.Contains(rr.Header().Get("Tus-Extension"), "creation") {
+		t.Fatalf("Unexpected OPTIONS response %d %v", rr.Code, rr.Header())
+	}
+
+	meta := "filename " + base64.StdEncoding.EncodeToString([]byte("My Talk.MP4"))
+	rr = serveTus(tusRequest("POST", "/uploads", map[string]string{"Upload-Length": "11", "Upload-Metadata": meta}, nil))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	location := rr.Header().Get("Location")
+	id := strings.TrimPrefix(location, "/uploads/")
+	if id == "" || id == location {
+		t.Fatalf("Unexpected Location %q", location)
+	}
+	if rr.Header().Get("Upload-Expires") == "" {
+		t.Error("Expected an Upload-Expires header")
+	}
+
+	patch := func(offset, body string) *httptest.ResponseRecorder {
+		return serveTus(tusRequest("PATCH", location, map[string]string{
+			"Upload-Offset": offset,
+			"Content-Type":  "application/offset+octet-stream",
+		}, strings.NewReader(body)))
+	}
+
+	if rr = patch("0", "hello"); rr.Code != http.StatusNoContent || rr.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("Unexpected first PATCH response %d %v", rr.Code, rr.Header())
+	}
+
+	// After a disconnect the client asks where to resume
+	rr = serveTus(tusRequest("HEAD", location, nil, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Upload-Offset") != "5" || rr.Header().Get("Upload-Length") != "11" {
+		t.Fatalf("Unexpected HEAD response %d %v", rr.Code, rr.Header())
+	}
+	if rr = patch("0", "hello"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a stale offset, got %d", rr.Code)
+	}
+
+	if rr = patch("5", " world"); rr.Code != http.StatusNoContent || rr.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("Unexpected last PATCH response %d %v", rr.Code, rr.Header())
+	}
+
+	// The finished upload is media under the same ID
+	media, err := db.GetMedia(id)
+	if err != nil {
+		t.Fatalf("Expected media for the finished upload: %v", err)
+	}
+	if media.OriginalName != "My Talk.MP4" || media.Filename != id+".mp4" || media.Size != 11 {
+		t.Errorf("Unexpected media %+v", media)
+	}
+	data, err := os.ReadFile(media.Path)
+	if err != nil || string(data) != "hello world" {
+		t.Errorf("Unexpected stored video %q, %v", data, err)
+	}
+
+	rr = serveTus(tusRequest("HEAD", location, nil, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a finished upload, got %d", rr.Code)
+	}
+}
+
+func TestTusUploadRejected(t *testing.T) {
+	useTestUploads(t)
+	originalMax, originalPostMax := MaxResumableUploadSize, MaxUploadSize
+	MaxResumableUploadSize, MaxUploadSize = 1024, 16
+	defer func() { MaxResumableUploadSize, MaxUploadSize = originalMax, originalPostMax }()
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{
+			name:       "Missing tus version",
+			req:        httptest.NewRequest("POST", "/uploads", nil),
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "Missing length",
+			req:        tusRequest("POST", "/uploads", nil, nil),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Over the size limit",
+			req:        tusRequest("POST", "/uploads", map[string]string{"Upload-Length": "4096"}, nil),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "Over the single POST limit",
+			req:        tusRequest("POST", "/uploads", map[string]string{"Upload-Length": "512"}, nil),
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "Unknown upload",
+			req:        tusRequest("HEAD", "/uploads/nope", nil, nil),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "Wrong content type",
+			req: tusRequest("PATCH", "/uploads/nope", map[string]string{
+				"Upload-Offset": "0",
+				"Content-Type":  "video/mp4",
+			}, strings.NewReader("data")),
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := serveTus(tt.req); rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTusUploadNoAudio(t *testing.T) {
+	db := useTestUploads(t)
+	stubProbe(t, nil, services.ErrNoAudio)
+
+	rr := serveTus(tusRequest("POST", "/uploads", map[string]string{"Upload-Length": "4"}, nil))
+	location := rr.Header().Get("Location")
+	rr = serveTus(tusRequest("PATCH", location, map[string]string{
+		"Upload-Offset": "0",
+		"Content-Type":  "application/offset+octet-stream",
+	}, strings.NewReader("mute")))
+
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "no audio track") {
+		t.Errorf("Expected 422 for a video without audio, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if list, _ := db.ListMedia(); len(list) != 0 {
+		t.Errorf("Expected no media records, got %+v", list)
+	}
+	entries, _ := os.ReadDir(UploadDir)
+	for _, e := range entries {
+		if !e.IsDir() {
+			t.Errorf("Expected the rejected file to be removed, found %s", e.Name())
+		}
+	}
+}
+
+func TestTusUploadDelete(t *testing.T) {
+	useTestUploads(t)
+
+	rr := serveTus(tusRequest("POST", "/uploads", map[string]string{"Upload-Length": "10"}, nil))
+	location := rr.Header().Get("Location")
+
+	if rr = serveTus(tusRequest("DELETE", location, nil, nil)); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", rr.Code)
+	}
+	if rr = serveTus(tusRequest("HEAD", location, nil, nil)); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after termination, got %d", rr.Code)
+	}
+}
+
+func TestParseTusMetadata(t *testing.T) {
+	header := "filename " + base64.StdEncoding.EncodeToString([]byte("a b.mp4")) + ",is_confidential, broken !!!"
+	meta := parseTusMetadata(header)
+	if meta["filename"] != "a b.mp4" {
+		t.Errorf("Expected filename a b.mp4, got %q", meta["filename"])
+	}
+	if _, ok := meta["is_confidential"]; !ok {
+		t.Error("Expected keys without a value to be kept")
+	}
+	if _, ok := meta["broken"]; ok {
+		t.Error("Expected malformed values to be skipped")
+	}
+}
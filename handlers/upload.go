@@ -1,16 +1,24 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"html"
 	"html/template"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+	"video-subtitle-generator/services"
 )
 
+// MaxUploadSize is the largest request body UploadHandler accepts.
+var MaxUploadSize int64 = 100 << 20
+
 // UploadHandler handles video file uploads
 func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("UploadHandler called")
@@ -18,44 +26,85 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if store == nil {
+		http.Error(w, "Store is not open", http.StatusServiceUnavailable)
+		return
+	}
 
-	// Limit upload size (e.g., 100MB)
-	r.ParseMultipartForm(100 << 20)
+	// Stream the body instead of letting ParseMultipartForm buffer it, and
+	// refuse to read past the limit
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		uploadError(w, "Expected a multipart upload", http.StatusBadRequest)
+		return
+	}
 
-	file, header, err := r.FormFile("videoFile")
+	var part *multipart.Part
+	for {
+		part, err = reader.NextPart()
+		if err != nil {
+			break
+		}
+		if part.FormName() == "videoFile" && part.FileName() != "" {
+			break
+		}
+		part.Close()
+	}
 	if err != nil {
-		http.Error(w, "Error retrieving file", http.StatusBadRequest)
+		if tooLarge(err) {
+			uploadTooLarge(w)
+			return
+		}
+		uploadError(w, "Error retrieving file", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
+	defer part.Close()
 
 	// Create uploads directory if not exists
-	uploadDir := "./static/uploads"
-	os.MkdirAll(uploadDir, os.ModePerm)
-
-	// Save file
-	// Sanitize filename: replace non-alphanumeric characters (except . and -) with _
-	safeFilename := func(name string) string {
-		var result []rune
-		for _, r := range name {
-			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
-				result = append(result, r)
-			} else {
-				result = append(result, '_')
-			}
+	if err := os.MkdirAll(UploadDir, os.ModePerm); err != nil {
+		log.Printf("Failed to create uploads dir: %v", err)
+		uploadError(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+
+	// The file is stored under its opaque media ID; the original name is
+	// only kept for display
+	id, err := services.NewID()
+	if err != nil {
+		uploadError(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+	originalName := filepath.Base(part.FileName())
+	filename := mediaFilename(id, originalName)
+	filePath := filepath.Join(UploadDir, filename)
+	size, err := saveUpload(part, filePath)
+	if err != nil {
+		if tooLarge(err) {
+			uploadTooLarge(w)
+			return
+		}
+		log.Printf("Failed to save upload %s: %v", filename, err)
+		uploadError(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+
+	info, err := probeUpload(filePath)
+	if err != nil {
+		var rejected *uploadRejected
+		if errors.As(err, &rejected) {
+			uploadError(w, rejected.msg, rejected.status)
+			return
 		}
-		return string(result)
+		uploadError(w, "Error saving file", http.StatusInternalServerError)
+		return
 	}
 
-	filename := fmt.Sprintf("%d_%s", time.Now().Unix(), safeFilename(header.Filename))
-	filePath := filepath.Join(uploadDir, filename)
-	dst, err := os.Create(filePath)
+	media, err := createMedia(id, originalName, filePath, size, info)
 	if err != nil {
-		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		uploadError(w, "Error saving file", http.StatusInternalServerError)
 		return
 	}
-	defer dst.Close()
-	io.Copy(dst, file)
 
 	// Render the player fragment
 	tmplPath := filepath.Join("templates", "player.html")
@@ -65,10 +114,118 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data := map[string]string{
-		"VideoPath": "/static/uploads/" + filename,
-		"LocalPath": filePath, // Hidden field for backend processing
+	tmpl.Execute(w, playerData(media))
+}
+
+// mediaFilename is the name an upload is stored under: its media ID plus the
+// extension of the original name.
+func mediaFilename(id, originalName string) string {
+	return id + strings.ToLower(filepath.Ext(safeFilename(originalName)))
+}
+
+// safeFilename replaces non-alphanumeric characters (except . and -) with _
+func safeFilename(name string) string {
+	var result []rune
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			result = append(result, r)
+		} else {
+			result = append(result, '_')
+		}
 	}
+	return string(result)
+}
+
+// probeMedia is services.ProbeMedia, swapped out in tests.
+var probeMedia = services.ProbeMedia
+
+// uploadRejected is an upload the client has to fix, with the status and
+// message to answer with.
+type uploadRejected struct {
+	status int
+	msg    string
+}
+
+func (e *uploadRejected) Error() string {
+	return e.msg
+}
+
+// probeUpload inspects a stored upload and removes it again if it can't be
+// transcribed, returning an *uploadRejected.
+func probeUpload(filePath string) (*services.MediaInfo, error) {
+	info, err := probeMedia(filePath)
+	if err == nil {
+		return info, nil
+	}
+	os.Remove(filePath)
+	if errors.Is(err, services.ErrNoAudio) {
+		return nil, &uploadRejected{http.StatusUnprocessableEntity, "The video has no audio track to transcribe"}
+	}
+	log.Printf("Rejected upload %s: %v", filepath.Base(filePath), err)
+	return nil, &uploadRejected{http.StatusUnsupportedMediaType, "The file is not a video or audio format that can be read"}
+}
+
+// createMedia records a stored upload so it can be reopened after a
+// restart. The file is removed if that fails.
+func createMedia(id, originalName, filePath string, size int64, info *services.MediaInfo) (*services.Media, error) {
+	media := &services.Media{
+		ID:           id,
+		Filename:     filepath.Base(filePath),
+		OriginalName: originalName,
+		Path:         filePath,
+		Size:         size,
+		CreatedAt:    time.Now(),
+		Info:         info,
+	}
+	if err := store.CreateMedia(media); err != nil {
+		log.Printf("Failed to record upload %s: %v", media.Filename, err)
+		os.Remove(filePath)
+		return nil, err
+	}
+	return media, nil
+}
+
+// saveUpload writes src to a temp file next to path and renames it into
+// place once it is complete, so a failed upload never leaves a partial file
+// under the final name. It returns the number of bytes written.
+func saveUpload(src io.Reader, path string) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+func tooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+func uploadTooLarge(w http.ResponseWriter) {
+	uploadError(w, "File is too large, the limit is "+formatSize(MaxUploadSize), http.StatusRequestEntityTooLarge)
+}
+
+func formatSize(n int64) string {
+	if n < 1<<20 {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	return fmt.Sprintf("%d MB", n>>20)
+}
 
-	tmpl.Execute(w, data)
+// uploadError renders an error fragment in place of the player.
+func uploadError(w http.ResponseWriter, msg string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<div class='error'>%s</div>", html.EscapeString(msg))
 }
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -9,8 +10,25 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"video-subtitle-generator/services"
 )
 
+// testMediaInfo is what stubProbe reports for a playable upload.
+var testMediaInfo = &services.MediaInfo{
+	Container: "mov,mp4,m4a,3gp,3g2,mj2",
+	Duration:  90 * time.Second,
+	Video:     &services.VideoStream{Codec: "h264", Width: 1280, Height: 720},
+	Audio:     []services.AudioStream{{Index: 1, Codec: "aac", Channels: 2, SampleRate: 48000}},
+}
+
+// stubProbe makes uploads probe as info and err until the test ends.
+func stubProbe(t *testing.T, info *services.MediaInfo, err error) {
+	t.Helper()
+	probeMedia = func(string) (*services.MediaInfo, error) { return info, err }
+	t.Cleanup(func() { probeMedia = services.ProbeMedia })
+}
+
 func TestUploadHandler(t *testing.T) {
 	// Setup temp dir
 	tmpDir, err := os.MkdirTemp("", "upload_test")
@@ -37,6 +55,9 @@ func TestUploadHandler(t *testing.T) {
 	}
 	defer os.Chdir(originalWd)
 
+	db := useTestStore(t)
+	stubProbe(t, testMediaInfo, nil)
+
 	// Prepare multipart request
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -65,20 +86,169 @@ func TestUploadHandler(t *testing.T) {
 	}
 
 	// Check body
-	if !strings.Contains(rr.Body.String(), "Video: /static/uploads/") {
+	if !strings.Contains(rr.Body.String(), "Video: /media/") {
 		t.Errorf("handler returned unexpected body: %v", rr.Body.String())
 	}
 
-	// Verify file exists in static/uploads
-	// The handler creates static/uploads in CWD (which is tmpDir)
-	// Filename is timestamp_safeFilename
-	// We just check if the directory has files
-	uploadsDir := filepath.Join(tmpDir, "static", "uploads")
+	// Verify file exists in the uploads dir
+	// The handler creates data/uploads in CWD (which is tmpDir)
+	// Filename is <media ID>.mp4
+	uploadsDir := filepath.Join(tmpDir, "data", "uploads")
 	entries, err := os.ReadDir(uploadsDir)
 	if err != nil {
 		t.Fatalf("Failed to read uploads dir: %v", err)
 	}
 	if len(entries) == 0 {
-		t.Error("No file uploaded to static/uploads")
+		t.Fatal("No file uploaded to data/uploads")
+	}
+
+	// The upload is recorded so it shows up in the library
+	list, err := db.ListMedia()
+	if err != nil {
+		t.Fatalf("Failed to list media: %v", err)
+	}
+	if len(list) != 1 || list[0].OriginalName != "test_video.mp4" || list[0].Filename != entries[0].Name() {
+		t.Fatalf("Unexpected media records %+v", list)
+	}
+	if list[0].Info == nil || list[0].Info.Video.Width != 1280 {
+		t.Errorf("Expected the probe result to be stored, got %+v", list[0].Info)
+	}
+	if list[0].Filename != list[0].ID+".mp4" {
+		t.Errorf("Expected the file to be named after the media ID, got %s", list[0].Filename)
+	}
+
+	// No server path is handed to the client
+	if strings.Contains(rr.Body.String(), uploadsDir) || strings.Contains(rr.Body.String(), "data/uploads") {
+		t.Errorf("Response leaks the upload path: %v", rr.Body.String())
+	}
+}
+
+func newUploadRequest(t *testing.T, field, filename string, content []byte) *http.Request {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("note", "fields before the file are skipped")
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestUploadHandlerRejected(t *testing.T) {
+	db := useTestStore(t)
+	stubProbe(t, testMediaInfo, nil)
+	uploadDir := filepath.Join(t.TempDir(), "uploads")
+	originalDir, originalMax := UploadDir, MaxUploadSize
+	UploadDir, MaxUploadSize = uploadDir, 1024
+	defer func() { UploadDir, MaxUploadSize = originalDir, originalMax }()
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Over the size limit",
+			req:        newUploadRequest(t, "videoFile", "big.mp4", bytes.Repeat([]byte("x"), 4096)),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantBody:   "File is too large, the limit is 1024 bytes",
+		},
+		{
+			name:       "No file field",
+			req:        newUploadRequest(t, "otherFile", "video.mp4", []byte("dummy")),
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Error retrieving file",
+		},
+		{
+			name:       "Not multipart",
+			req:        httptest.NewRequest("POST", "/upload", strings.NewReader("videoFile=x")),
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Expected a multipart upload",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			UploadHandler(rr, tt.req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body containing %q, got %q", tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+
+	// Partial files are cleaned up and nothing is recorded
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 0 {
+		t.Errorf("Expected no files left behind, got %d", len(entries))
+	}
+	if list, _ := db.ListMedia(); len(list) != 0 {
+		t.Errorf("Expected no media records, got %+v", list)
+	}
+}
+
+func TestUploadHandlerProbe(t *testing.T) {
+	db := useTestStore(t)
+	uploadDir := filepath.Join(t.TempDir(), "uploads")
+	originalDir := UploadDir
+	UploadDir = uploadDir
+	defer func() { UploadDir = originalDir }()
+
+	tests := []struct {
+		name       string
+		probeErr   error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "No audio",
+			probeErr:   services.ErrNoAudio,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "no audio track",
+		},
+		{
+			name:       "Not media",
+			probeErr:   errors.New("ffprobe failed: exit status 1, output: Invalid data found when processing input"),
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantBody:   "not a video or audio format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubProbe(t, nil, tt.probeErr)
+			rr := httptest.NewRecorder()
+			UploadHandler(rr, newUploadRequest(t, "videoFile", "video.mp4", []byte("not really a video")))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body containing %q, got %q", tt.wantBody, rr.Body.String())
+			}
+			// The rejected file must not leak the probe output to the client
+			if strings.Contains(rr.Body.String(), "ffprobe") {
+				t.Errorf("Response leaks the probe error: %q", rr.Body.String())
+			}
+		})
+	}
+
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 0 {
+		t.Errorf("Expected rejected files to be removed, got %d", len(entries))
+	}
+	if list, _ := db.ListMedia(); len(list) != 0 {
+		t.Errorf("Expected no media records, got %+v", list)
 	}
 }
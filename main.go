@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
 
 	"video-subtitle-generator/handlers"
+	"video-subtitle-generator/services"
 )
 
 func main() {
@@ -16,6 +26,162 @@ func main() {
 		port = "8080"
 	}
 
+	// Register transcription backends
+	local := services.LocalWhisper{DefaultModel: os.Getenv("WHISPER_MODEL")}
+	if !local.Capabilities().SupportsModel(local.DefaultModel) {
+		log.Fatalf("Invalid WHISPER_MODEL: unknown model %q", local.DefaultModel)
+	}
+	command, err := services.FindWhisper(services.WhisperSearch{
+		Path:   os.Getenv("WHISPER_BIN"),
+		Venv:   os.Getenv("WHISPER_VENV"),
+		Python: os.Getenv("WHISPER_PYTHON"),
+	})
+	if err == nil {
+		local.Command = command
+	} else if os.Getenv("WHISPER_BIN") != "" {
+		log.Fatal("Invalid WHISPER_BIN: ", err)
+	}
+	// Without a whisper found now, each job looks again, so installing it
+	// doesn't need a restart
+	services.RegisterTranscriber(local)
+	timeout := services.DefaultAPITimeout
+	if seconds, err := strconv.Atoi(os.Getenv("OPENAI_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	client := services.NewAPIClient(timeout)
+	if n, err := strconv.Atoi(os.Getenv("OPENAI_MAX_RETRIES")); err == nil && n >= 0 {
+		client.MaxRetries = n
+	}
+	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+		profile := services.OpenAIProfile
+		profile.APIKey = apiKey
+		profile.DefaultModel = os.Getenv("OPENAI_MODEL")
+		if profile.DefaultModel != "" && !slices.Contains(profile.Models, profile.DefaultModel) {
+			log.Fatalf("Invalid OPENAI_MODEL: unknown model %q", profile.DefaultModel)
+		}
+		services.RegisterTranscriber(services.OpenAI{Profile: profile, Client: client})
+	}
+	// Each OpenAI-compatible server in the profiles file is a backend too
+	if path := os.Getenv("API_PROFILES"); path != "" {
+		profiles, err := services.LoadAPIProfiles(path)
+		if err != nil {
+			log.Fatal("Invalid API_PROFILES: ", err)
+		}
+		for _, profile := range profiles {
+			if _, err := services.GetTranscriber(profile.Name); err == nil {
+				log.Fatalf("Invalid API_PROFILES: backend %q already exists", profile.Name)
+			}
+			profileClient := client
+			if profile.TimeoutSeconds > 0 {
+				profileClient = services.NewAPIClient(time.Duration(profile.TimeoutSeconds) * time.Second)
+				profileClient.MaxRetries = client.MaxRetries
+			}
+			services.RegisterTranscriber(services.OpenAI{Profile: profile, Client: profileClient})
+		}
+	}
+	// whisper.cpp runs either against a server or with a directory of models
+	if server := os.Getenv("WHISPER_CPP_SERVER"); server != "" {
+		var serverTimeout time.Duration
+		if seconds, err := strconv.Atoi(os.Getenv("WHISPER_CPP_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+			serverTimeout = time.Duration(seconds) * time.Second
+		}
+		services.RegisterTranscriber(services.WhisperCpp{ServerURL: server, Client: services.NewWhisperCppClient(serverTimeout)})
+	} else if dir := os.Getenv("WHISPER_CPP_MODELS"); dir != "" {
+		models, err := services.WhisperCppModels(dir)
+		if err != nil {
+			log.Fatal("Invalid WHISPER_CPP_MODELS: ", err)
+		}
+		threads, _ := strconv.Atoi(os.Getenv("WHISPER_CPP_THREADS"))
+		services.RegisterTranscriber(services.WhisperCpp{
+			Binary:   os.Getenv("WHISPER_CPP_BIN"),
+			ModelDir: dir,
+			Models:   models,
+			Threads:  threads,
+		})
+	}
+	// faster-whisper is offered when its CLI is configured or installed
+	if bin := os.Getenv("FASTER_WHISPER_BIN"); bin != "" || hasCommand("whisper-ctranslate2") {
+		threads, _ := strconv.Atoi(os.Getenv("FASTER_WHISPER_THREADS"))
+		services.RegisterTranscriber(services.FasterWhisper{
+			Binary:       bin,
+			DefaultModel: os.Getenv("FASTER_WHISPER_MODEL"),
+			ComputeType:  os.Getenv("FASTER_WHISPER_COMPUTE_TYPE"),
+			Device:       os.Getenv("FASTER_WHISPER_DEVICE"),
+			Threads:      threads,
+		})
+	}
+	// The fake backend stands in for whisper when developing the UI
+	if os.Getenv("FAKE_TRANSCRIBER") != "" {
+		services.RegisterTranscriber(fakeTranscriber())
+	}
+	// Routing rules and fallbacks refer to the backends registered above
+	if path := os.Getenv("TRANSCRIBE_ROUTES"); path != "" {
+		routes, err := services.LoadRoutes(path)
+		if err != nil {
+			log.Fatal("Invalid TRANSCRIBE_ROUTES: ", err)
+		}
+		handlers.Routes = routes
+	}
+	if backend := os.Getenv("TRANSCRIBER"); backend != "" {
+		handlers.DefaultBackend = backend
+	}
+	if handlers.DefaultBackend == services.AutoBackend {
+		if handlers.Routes == nil {
+			log.Fatal("Invalid TRANSCRIBER setting: auto needs TRANSCRIBE_ROUTES")
+		}
+	} else if _, err := services.GetTranscriber(handlers.DefaultBackend); err != nil {
+		log.Fatal("Invalid TRANSCRIBER setting: ", err)
+	}
+	// Report the external tools found, so a missing one shows up now
+	// rather than as failed jobs
+	for _, check := range services.CheckTools(services.Transcribers()) {
+		log.Print("Self-check: ", check)
+	}
+
+	// Open the database of uploads, jobs and transcripts
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	handlers.UploadDir = filepath.Join(dataDir, "uploads")
+	handlers.AudioCacheDir = filepath.Join(dataDir, "cache", "audio")
+	if mb, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_MB"), 10, 64); err == nil && mb > 0 {
+		handlers.MaxUploadSize = mb << 20
+	}
+	if mb, err := strconv.ParseInt(os.Getenv("MAX_RESUMABLE_UPLOAD_MB"), 10, 64); err == nil && mb > 0 {
+		handlers.MaxResumableUploadSize = mb << 20
+	}
+	store, err := services.OpenStore(filepath.Join(dataDir, "subtitles.db"))
+	if err != nil {
+		log.Fatal("Failed to open store: ", err)
+	}
+	defer store.Close()
+	// Jobs that were running when the server stopped have no worker anymore
+	if n, err := store.FailUnfinishedJobs("interrupted by a server restart"); err != nil {
+		log.Fatal("Failed to recover jobs: ", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted jobs as failed", n)
+	}
+
+	// Start the transcription workers
+	workers := 2
+	if n, err := strconv.Atoi(os.Getenv("TRANSCRIBE_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+	queue := handlers.Start(store, workers)
+	defer queue.Close()
+
+	// Drop resumable uploads that were abandoned part way
+	if hours, err := strconv.Atoi(os.Getenv("UPLOAD_EXPIRY_HOURS")); err == nil && hours > 0 {
+		handlers.UploadExpiry = time.Duration(hours) * time.Hour
+	}
+	go func() {
+		for {
+			handlers.ExpireUploads()
+			time.Sleep(time.Hour)
+		}
+	}()
+
 	// Serve static files
 	fs := http.FileServer(http.Dir("./static"))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
@@ -23,12 +189,61 @@ func main() {
 	// Define routes
 	http.HandleFunc("/", handlers.HomeHandler)
 	http.HandleFunc("/upload", handlers.UploadHandler)
+	http.HandleFunc("/uploads", handlers.TusHandler)
+	http.HandleFunc("/uploads/{id}", handlers.TusUploadHandler)
 	http.HandleFunc("/transcribe", handlers.TranscribeHandler)
+	http.HandleFunc("/media/{id}", handlers.MediaHandler)
+	http.HandleFunc("/media/{id}/video", handlers.MediaVideoHandler)
+	http.HandleFunc("/jobs/{id}", handlers.JobHandler)
+	http.HandleFunc("/jobs/{id}/events", handlers.JobEventsHandler)
+	http.HandleFunc("/subtitles/{name}", handlers.SubtitlesHandler)
+
+	// Ctrl-C and SIGTERM stop the server so the deferred cleanup runs:
+	// closing the queue kills running tools, which are in their own
+	// process groups and would otherwise outlive the server
+	server := &http.Server{Addr: ":" + port}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Print("Shutting down")
+		server.Close()
+	}()
 
 	// Start server
 	fmt.Printf("Server starting on http://localhost:%s\n", port)
-	err := http.ListenAndServe(":"+port, nil)
-	if err != nil {
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("Server failed to start: ", err)
 	}
 }
+
+// fakeTranscriber configures the fake backend from FAKE_* variables.
+func fakeTranscriber() *services.Fake {
+	fake := &services.Fake{Failure: os.Getenv("FAKE_FAILURE")}
+	if path := os.Getenv("FAKE_SCRIPT"); path != "" {
+		script, err := services.LoadFakeScript(path)
+		if err != nil {
+			log.Fatal("Invalid FAKE_SCRIPT: ", err)
+		}
+		fake.Script = script
+	}
+	if v := os.Getenv("FAKE_LATENCY"); v != "" {
+		latency, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid FAKE_LATENCY: ", err)
+		}
+		fake.Latency = latency
+	}
+	if _, ok := services.FakeFailures[fake.Failure]; fake.Failure != "" && !ok {
+		log.Fatalf("Invalid FAKE_FAILURE: unknown failure %q", fake.Failure)
+	}
+	fake.FailEvery, _ = strconv.Atoi(os.Getenv("FAKE_FAIL_EVERY"))
+	return fake
+}
+
+// hasCommand reports whether name is in PATH.
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of API failure, for errors.Is on an *APIError.
+var (
+	ErrAPIAuth        = errors.New("the API key was rejected")
+	ErrAPIQuota       = errors.New("the API account is out of quota")
+	ErrAPIRateLimited = errors.New("the API is rate limiting requests")
+	ErrAPITooLarge    = errors.New("the audio is too large for the API")
+	ErrAPIRequest     = errors.New("the API rejected the request")
+	ErrAPIServer      = errors.New("the API server failed")
+)
+
+// APIError is a failed response from a transcription API.
+type APIError struct {
+	Status int
+	// Code is the API's error code, e.g. "invalid_api_key", when it sends one.
+	Code    string
+	Message string
+	// Kind is one of the ErrAPI errors.
+	Kind error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	return fmt.Sprintf("API request failed with status %d: %s", e.Status, msg)
+}
+
+func (e *APIError) Unwrap() error { return e.Kind }
+
+// newAPIError reads an error response. OpenAI-style servers send
+// {"error": {"message": ..., "code": ...}}; anything else is kept as text.
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	var parsed struct {
+		Error struct {
+			Message string `json:"message"`
+			Code    any    `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error.Message != "" {
+		e.Message = parsed.Error.Message
+		if parsed.Error.Code != nil {
+			e.Code = fmt.Sprint(parsed.Error.Code)
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.Kind = ErrAPIAuth
+	case resp.StatusCode == http.StatusTooManyRequests && e.Code == "insufficient_quota":
+		e.Kind = ErrAPIQuota
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrAPIRateLimited
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		e.Kind = ErrAPITooLarge
+	case resp.StatusCode >= 500:
+		e.Kind = ErrAPIServer
+	default:
+		e.Kind = ErrAPIRequest
+	}
+	return e
+}
+
+// APIClient sends requests to a transcription API, retrying rate limits,
+// server errors and dropped connections with exponential backoff.
+type APIClient struct {
+	HTTP *http.Client
+	// MaxRetries is how many times a failed request is retried.
+	MaxRetries int
+	// BaseDelay is the wait before the first retry; each retry doubles it,
+	// up to MaxDelay. The wait is jittered so parallel chunks don't retry
+	// in lockstep.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetryAfter is the longest Retry-After the client waits for. A
+	// server asking for longer fails the request instead.
+	MaxRetryAfter time.Duration
+	// RetryTimeouts retries requests that ran out of HTTP.Timeout. That
+	// only helps when requests are small enough to usually finish in time;
+	// a whole file that timed out will time out again.
+	RetryTimeouts bool
+
+	// sleep waits for d or until ctx is done; tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewAPIClient returns a client that gives each request timeout, including
+// the upload, and retries up to three times, timeouts included. Zero
+// timeout leaves requests to the job's context.
+func NewAPIClient(timeout time.Duration) *APIClient {
+	return &APIClient{
+		HTTP:          &http.Client{Timeout: timeout},
+		MaxRetries:    3,
+		BaseDelay:     time.Second,
+		MaxDelay:      30 * time.Second,
+		MaxRetryAfter: 2 * time.Minute,
+		RetryTimeouts: true,
+	}
+}
+
+// DefaultAPITimeout leaves room to upload 25 MB on a slow connection and for
+// the API to transcribe it.
+const DefaultAPITimeout = 10 * time.Minute
+
+var defaultAPIClient = NewAPIClient(DefaultAPITimeout)
+
+// Do sends the request newRequest builds, building a fresh one for each
+// attempt since a streamed body can only be read once. It returns the
+// response if it is a success, or else an error that is an *APIError when
+// the server answered.
+func (c *APIClient) Do(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	sleep := c.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.HTTP.Do(req)
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			// Cancellation is final; anything else is the network
+			if ctx.Err() != nil {
+				return nil, context.Cause(ctx)
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !c.RetryTimeouts {
+				return nil, err
+			}
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return resp, nil
+		default:
+			apiErr := newAPIError(resp)
+			resp.Body.Close()
+			err = apiErr
+			if apiErr.Kind != ErrAPIRateLimited && apiErr.Kind != ErrAPIServer {
+				return nil, err
+			}
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > c.MaxRetryAfter {
+					return nil, fmt.Errorf("%w (retry after %v)", err, retryAfter.Round(time.Second))
+				}
+				wait = retryAfter
+			}
+		}
+
+		if attempt >= c.MaxRetries {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff is the jittered wait before retry number attempt+1: half the
+// exponential delay plus a random part of the other half.
+func (c *APIClient) backoff(attempt int) time.Duration {
+	delay := c.BaseDelay << attempt
+	if delay > c.MaxDelay || delay <= 0 {
+		delay = c.MaxDelay
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testAPIClient returns a client that records its waits instead of sleeping.
+func testAPIClient(waits *[]time.Duration) *APIClient {
+	c := NewAPIClient(5 * time.Second)
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+	return c
+}
+
+func getRequest(url string) func(ctx context.Context) (*http.Request, error) {
+	return func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", url, nil)
+	}
+}
+
+func TestAPIClientRetries(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch attempts {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error": {"message": "Rate limit reached", "code": "rate_limit_exceeded"}}`)
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer ts.Close()
+
+	var waits []time.Duration
+	resp, err := testAPIClient(&waits).Do(context.Background(), getRequest(ts.URL))
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if attempts != 3 || len(waits) != 2 {
+		t.Fatalf("Expected 3 attempts with 2 waits, got %d and %v", attempts, waits)
+	}
+	// The first wait is jittered between half and all of BaseDelay
+	if waits[0] < 500*time.Millisecond || waits[0] > time.Second {
+		t.Errorf("Expected a backoff of 0.5s-1s, got %v", waits[0])
+	}
+	if waits[1] != 7*time.Second {
+		t.Errorf("Expected to wait the 7s Retry-After, got %v", waits[1])
+	}
+}
+
+func TestAPIClientErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		retryAfter   string
+		wantKind     error
+		wantAttempts int
+	}{
+		{"Bad key", http.StatusUnauthorized, `{"error": {"message": "Incorrect API key provided", "code": "invalid_api_key"}}`, "", ErrAPIAuth, 1},
+		{"Out of quota", http.StatusTooManyRequests, `{"error": {"message": "You exceeded your current quota", "code": "insufficient_quota"}}`, "", ErrAPIQuota, 1},
+		{"Too large", http.StatusRequestEntityTooLarge, "Maximum content size limit exceeded", "", ErrAPITooLarge, 1},
+		{"Bad request", http.StatusBadRequest, `{"error": {"message": "Invalid file format", "code": null}}`, "", ErrAPIRequest, 1},
+		{"Server down", http.StatusBadGateway, "", "", ErrAPIServer, 4},
+		// Waiting an hour is worse than failing
+		{"Long Retry-After", http.StatusTooManyRequests, "", "3600", ErrAPIRateLimited, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer ts.Close()
+
+			var waits []time.Duration
+			_, err := testAPIClient(&waits).Do(context.Background(), getRequest(ts.URL))
+			if !errors.Is(err, tt.wantKind) {
+				t.Errorf("Expected %v, got %v", tt.wantKind, err)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+				t.Errorf("Expected an APIError with status %d, got %#v", tt.status, err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestAPIClientCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewAPIClient(5 * time.Second)
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		// The job is cancelled while waiting to retry
+		cancel()
+		return sleepContext(ctx, d)
+	}
+	if _, err := c.Do(ctx, getRequest(ts.URL)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancellation, got %v", err)
+	}
+}
+
+func TestAPIClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	var waits []time.Duration
+	c := testAPIClient(&waits)
+	c.HTTP.Timeout = 50 * time.Millisecond
+	c.MaxRetries = 1
+	if _, err := c.Do(context.Background(), getRequest(ts.URL)); err == nil {
+		t.Fatal("Expected a timeout")
+	}
+	// Timeouts are retried like dropped connections
+	if len(waits) != 1 {
+		t.Errorf("Expected one retry, got %v", waits)
+	}
+
+	// unless the client sends whole files, which would only time out again
+	waits = nil
+	c.RetryTimeouts = false
+	if _, err := c.Do(context.Background(), getRequest(ts.URL)); err == nil {
+		t.Fatal("Expected a timeout")
+	}
+	if len(waits) != 0 {
+		t.Errorf("Expected no retries, got %v", waits)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"30", 30 * time.Second, true},
+		{"Wed, 01 May 2024 12:01:30 GMT", 90 * time.Second, true},
+		{"Wed, 01 May 2024 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -1,29 +1,197 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 var execCommand = exec.Command
 
-// ExtractAudio extracts audio from a video file and saves it as an MP3.
-// Returns the path to the generated audio file.
+// AudioProfile is an ffmpeg output format for extracted audio.
+type AudioProfile struct {
+	Name string
+	// Ext is the output file extension, including the dot.
+	Ext string
+	// Args are the ffmpeg output options.
+	Args []string
+}
+
+var (
+	// ProfileWAV is 16 kHz mono PCM, the format whisper resamples
+	// everything to anyway. It is the default, and best for local backends.
+	ProfileWAV = AudioProfile{
+		Name: "wav16k",
+		Ext:  ".wav",
+		Args: []string{"-ac", "1", "-ar", "16000", "-c:a", "pcm_s16le"},
+	}
+	// ProfileFLAC is ProfileWAV losslessly compressed to roughly half the
+	// size.
+	ProfileFLAC = AudioProfile{
+		Name: "flac16k",
+		Ext:  ".flac",
+		Args: []string{"-ac", "1", "-ar", "16000", "-c:a", "flac"},
+	}
+	// ProfileOpus is low-bitrate speech audio, about 15 MB an hour, for APIs
+	// with upload size limits.
+	ProfileOpus = AudioProfile{
+		Name: "opus",
+		Ext:  ".ogg",
+		Args: []string{"-ac", "1", "-ar", "16000", "-c:a", "libopus", "-b:a", "32k", "-application", "voip"},
+	}
+)
+
+// ExtractOptions tune ExtractAudioWithOptions.
+type ExtractOptions struct {
+	// Stream picks the audio stream to extract, counting audio streams
+	// only: 0 is the first, as in MediaInfo.Audio.
+	Stream int
+	// Profile is the output format. The zero value means ProfileWAV.
+	Profile AudioProfile
+	// Filters is an ffmpeg filter chain applied to the audio, such as a
+	// FilterPreset's.
+	Filters []string
+	// CacheDir, if set, keeps extracted audio keyed by a hash of the video's
+	// content, so extracting the same track again skips ffmpeg. Without it
+	// the audio is written next to the video.
+	CacheDir string
+	// Progress, if set, receives how much of the video ffmpeg has processed.
+	Progress ProgressFunc
+}
+
+// ExtractAudio extracts the first audio stream from a video file as 16 kHz
+// mono WAV. Returns the path to the generated audio file.
 func ExtractAudio(videoPath string) (string, error) {
-	// Construct output path (replace extension with .mp3)
-	ext := filepath.Ext(videoPath)
-	audioPath := strings.TrimSuffix(videoPath, ext) + ".mp3"
+	return ExtractAudioWithOptions(context.Background(), videoPath, ExtractOptions{})
+}
 
-	// ffmpeg command: -i input -q:a 0 -map a output.mp3
-	// -y to overwrite if exists
-	cmd := execCommand("ffmpeg", "-y", "-i", videoPath, "-q:a", "0", "-map", "a", audioPath)
+// ExtractAudioWithOptions is ExtractAudio for the stream and format in opts.
+// Each stream and profile gets its own file, so tracks can be transcribed
+// side by side. Cancelling ctx stops ffmpeg.
+func ExtractAudioWithOptions(ctx context.Context, videoPath string, opts ExtractOptions) (string, error) {
+	if opts.Stream < 0 {
+		return "", fmt.Errorf("invalid audio stream %d", opts.Stream)
+	}
+	profile := opts.Profile
+	if profile.Name == "" {
+		profile = ProfileWAV
+	}
 
-	output, err := cmd.CombinedOutput()
+	// Construct output path (replace extension with the profile's). Cached
+	// files also carry the profile name, as two profiles can share an
+	// extension. Filtered audio is told apart by a hash of the chain.
+	var filtered string
+	if len(opts.Filters) > 0 {
+		filtered = ".af-" + filterKey(opts.Filters)
+	}
+	base := strings.TrimSuffix(videoPath, filepath.Ext(videoPath))
+	if opts.Stream > 0 {
+		base = fmt.Sprintf("%s.track%d", base, opts.Stream)
+	}
+	audioPath := base + filtered + profile.Ext
+	if opts.CacheDir != "" {
+		hash, err := contentHash(videoPath)
+		if err != nil {
+			return "", err
+		}
+		audioPath = filepath.Join(opts.CacheDir, fmt.Sprintf("%s.track%d.%s%s%s", hash, opts.Stream, profile.Name, filtered, profile.Ext))
+		if _, err := os.Stat(audioPath); err == nil {
+			return audioPath, nil
+		}
+		if err := os.MkdirAll(opts.CacheDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create audio cache: %v", err)
+		}
+	}
+
+	// ffmpeg writes to a unique temp name that is renamed once complete, so
+	// an interrupted run never leaves a truncated file that looks cached and
+	// two jobs extracting the same track don't write over each other
+	suffix, err := NewID()
 	if err != nil {
+		return "", err
+	}
+	tmpPath := strings.TrimSuffix(audioPath, profile.Ext) + ".partial-" + suffix[:8] + profile.Ext
+
+	// ffmpeg command: -i input -map 0:a:N [-af filters] <profile args> output
+	// Mapping a single stream matters: plain -map a mixes every audio track
+	// into one file. -y to overwrite a leftover temp file, -progress pipe:1
+	// for machine-readable progress on stdout in place of the -stats line
+	args := []string{"-y", "-nostats", "-progress", "pipe:1", "-i", videoPath,
+		"-map", fmt.Sprintf("0:a:%d", opts.Stream)}
+	if len(opts.Filters) > 0 {
+		args = append(args, "-af", strings.Join(opts.Filters, ","))
+	}
+	args = append(args, profile.Args...)
+	args = append(args, tmpPath)
+	cmd := execCommand("ffmpeg", args...)
+
+	var onLine func(string)
+	if opts.Progress != nil {
+		tracker := &ffmpegProgress{report: opts.Progress}
+		onLine = tracker.line
+	}
+
+	output, err := runCommand(ctx, cmd, onLine)
+	if err != nil {
+		os.Remove(tmpPath)
 		return "", fmt.Errorf("ffmpeg failed: %v, output: %s", err, string(output))
 	}
+	if err := os.Rename(tmpPath, audioPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to save audio: %v", err)
+	}
 
 	return audioPath, nil
 }
+
+// hashCache remembers content hashes, so a multi-GB video is only read once
+// per process. Entries are keyed by path and invalidated when the file's
+// size or modification time changes.
+var hashCache = struct {
+	sync.Mutex
+	entries map[string]hashEntry
+}{entries: make(map[string]hashEntry)}
+
+type hashEntry struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// contentHash returns the hex SHA-256 of the file at path.
+func contentHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	hashCache.Lock()
+	entry, ok := hashCache.entries[path]
+	hashCache.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.hash, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	hashCache.Lock()
+	hashCache.entries[path] = hashEntry{size: info.Size(), modTime: info.ModTime(), hash: hash}
+	hashCache.Unlock()
+	return hash, nil
+}
@@ -1,10 +1,15 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestHelperProcess isn't a real test. It's used to mock exec.Command.
@@ -27,33 +32,206 @@ func TestHelperProcess(t *testing.T) {
 	}
 
 	cmd := args[0]
+	if cmd == "ffmpeg" && strings.Contains(strings.Join(args, " "), "silencedetect") {
+		fmt.Fprintf(os.Stderr, "  Duration: 00:00:10.00, start: 0.000000, bitrate: 80 kb/s\n")
+		fmt.Fprintf(os.Stderr, "[silencedetect @ 0x1] silence_start: 2\n")
+		fmt.Fprintf(os.Stderr, "[silencedetect @ 0x1] silence_end: 2.4 | silence_duration: 0.4\n")
+		fmt.Fprintf(os.Stderr, "[silencedetect @ 0x1] silence_start: 4.5\n")
+		fmt.Fprintf(os.Stderr, "[silencedetect @ 0x1] silence_end: 4.9 | silence_duration: 0.4\n")
+		os.Exit(0)
+	}
 	if cmd == "ffmpeg" {
-		// Verify arguments if needed
-		// Just exit success
+		// Print the banner and progress lines a real run would
+		fmt.Fprintf(os.Stderr, "Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'test_video.mp4':\n")
+		fmt.Fprintf(os.Stderr, "  Duration: 00:00:10.00, start: 0.000000, bitrate: 1000 kb/s\n")
+		// Like a real run, the banner is read well before any progress
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(os.Stdout, "out_time_us=5000000\nprogress=continue\n")
+		fmt.Fprintf(os.Stdout, "out_time_us=10000000\nprogress=end\n")
+		// The output file is the last argument
+		if err := os.WriteFile(args[len(args)-1], []byte("audio"), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 	fmt.Fprintf(os.Stderr, "Unknown command %q\n", cmd)
 	os.Exit(2)
 }
 
-func TestExtractAudio(t *testing.T) {
-	// Mock execCommand
+// mockFFmpeg swaps execCommand for TestHelperProcess until the test ends. It
+// returns a pointer to the arguments of the last run and how many runs there
+// were.
+func mockFFmpeg(t *testing.T) (*[]string, *int) {
+	t.Helper()
+	var args []string
+	var runs int
 	execCommand = func(name string, arg ...string) *exec.Cmd {
+		args = arg
+		runs++
 		cs := []string{"-test.run=TestHelperProcess", "--", name}
 		cs = append(cs, arg...)
 		cmd := exec.Command(os.Args[0], cs...)
 		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
 		return cmd
 	}
-	defer func() { execCommand = exec.Command }()
+	t.Cleanup(func() { execCommand = exec.Command })
+	return &args, &runs
+}
+
+func TestExtractAudio(t *testing.T) {
+	args, _ := mockFFmpeg(t)
 
 	// Test
-	videoPath := "test_video.mp4"
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "test_video.mp4")
 	audioPath, err := ExtractAudio(videoPath)
 	if err != nil {
-		t.Errorf("ExtractAudio failed: %v", err)
+		t.Fatalf("ExtractAudio failed: %v", err)
+	}
+	if want := filepath.Join(dir, "test_video.wav"); audioPath != want {
+		t.Errorf("Expected audio path %q, got %q", want, audioPath)
+	}
+	// Whisper wants 16 kHz mono, so that is the default
+	if joined := strings.Join(*args, " "); !strings.Contains(joined, "-ac 1 -ar 16000 -c:a pcm_s16le") {
+		t.Errorf("Expected 16 kHz mono PCM, got args %q", joined)
+	}
+	// Only the finished file is left behind
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the audio file, got %v", entries)
+	}
+}
+
+func TestExtractAudioProgress(t *testing.T) {
+	mockFFmpeg(t)
+
+	var positions []time.Duration
+	var total time.Duration
+	videoPath := filepath.Join(t.TempDir(), "test_video.mp4")
+	_, err := ExtractAudioWithOptions(context.Background(), videoPath, ExtractOptions{Progress: func(position, duration time.Duration) {
+		positions = append(positions, position)
+		total = duration
+	}})
+	if err != nil {
+		t.Fatalf("ExtractAudioWithOptions failed: %v", err)
+	}
+
+	if total != 10*time.Second {
+		t.Errorf("Expected total duration 10s, got %v", total)
+	}
+	if len(positions) == 0 || positions[len(positions)-1] != 10*time.Second {
+		t.Errorf("Expected progress to reach 10s, got %v", positions)
+	}
+}
+
+func TestExtractAudioStream(t *testing.T) {
+	args, _ := mockFFmpeg(t)
+	dir := t.TempDir()
+
+	tests := []struct {
+		stream   int
+		profile  AudioProfile
+		wantMap  string
+		wantPath string
+	}{
+		{0, AudioProfile{}, "0:a:0", "test_video.wav"},
+		{1, AudioProfile{}, "0:a:1", "test_video.track1.wav"},
+		{1, ProfileOpus, "0:a:1", "test_video.track1.ogg"},
+	}
+
+	for _, tt := range tests {
+		audioPath, err := ExtractAudioWithOptions(context.Background(), filepath.Join(dir, "test_video.mkv"), ExtractOptions{Stream: tt.stream, Profile: tt.profile})
+		if err != nil {
+			t.Fatalf("ExtractAudioWithOptions failed: %v", err)
+		}
+		if want := filepath.Join(dir, tt.wantPath); audioPath != want {
+			t.Errorf("Stream %d: expected audio path %q, got %q", tt.stream, want, audioPath)
+		}
+		joined := strings.Join(*args, " ")
+		if !strings.Contains(joined, "-map "+tt.wantMap+" ") {
+			t.Errorf("Stream %d: expected -map %s, got args %q", tt.stream, tt.wantMap, joined)
+		}
+	}
+
+	if _, err := ExtractAudioWithOptions(context.Background(), filepath.Join(dir, "test_video.mkv"), ExtractOptions{Stream: -1}); err == nil {
+		t.Error("Expected an error for a negative stream")
+	}
+}
+
+func TestExtractAudioCache(t *testing.T) {
+	_, runs := mockFFmpeg(t)
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+
+	// Two uploads of the same content share their audio
+	first := filepath.Join(dir, "first.mp4")
+	second := filepath.Join(dir, "second.mp4")
+	for _, path := range []string{first, second} {
+		if err := os.WriteFile(path, []byte("same video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := ExtractOptions{Profile: ProfileFLAC, CacheDir: cacheDir}
+	audioPath, err := ExtractAudioWithOptions(context.Background(), first, opts)
+	if err != nil {
+		t.Fatalf("ExtractAudioWithOptions failed: %v", err)
+	}
+	if filepath.Dir(audioPath) != cacheDir || !strings.HasSuffix(audioPath, ".track0.flac16k.flac") {
+		t.Errorf("Expected a cached FLAC file, got %q", audioPath)
+	}
+
+	again, err := ExtractAudioWithOptions(context.Background(), second, opts)
+	if err != nil {
+		t.Fatalf("ExtractAudioWithOptions failed: %v", err)
+	}
+	if again != audioPath || *runs != 1 {
+		t.Errorf("Expected the cached %q without running ffmpeg again, got %q after %d runs", audioPath, again, *runs)
+	}
+
+	// Another profile or different content is extracted again
+	if _, err := ExtractAudioWithOptions(context.Background(), first, ExtractOptions{Profile: ProfileOpus, CacheDir: cacheDir}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("edited video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	edited, err := ExtractAudioWithOptions(context.Background(), second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited == audioPath || *runs != 3 {
+		t.Errorf("Expected new extractions for another profile and changed content, got %q after %d runs", edited, *runs)
+	}
+}
+
+func TestExtractAudioFilters(t *testing.T) {
+	args, _ := mockFFmpeg(t)
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "test_video.mp4")
+
+	preset, err := GetFilterPreset("voice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audioPath, err := ExtractAudioWithOptions(context.Background(), videoPath, ExtractOptions{Filters: preset.Filters})
+	if err != nil {
+		t.Fatalf("ExtractAudioWithOptions failed: %v", err)
+	}
+	joined := strings.Join(*args, " ")
+	if !strings.Contains(joined, "-af "+preset.Chain()+" ") {
+		t.Errorf("Expected -af %s, got args %q", preset.Chain(), joined)
+	}
+	// Filtered audio doesn't replace the plain extraction
+	plain := filepath.Join(dir, "test_video.wav")
+	if audioPath == plain || !strings.HasSuffix(audioPath, ".wav") {
+		t.Errorf("Expected a separate filtered WAV, got %q", audioPath)
+	}
+	if _, err := ExtractAudioWithOptions(context.Background(), videoPath, ExtractOptions{}); err != nil {
+		t.Fatal(err)
 	}
-	if audioPath != "test_video.mp3" {
-		t.Errorf("Expected audio path 'test_video.mp3', got '%s'", audioPath)
+	if slices.Contains(*args, "-af") {
+		t.Errorf("Expected no filters by default, got args %q", *args)
 	}
 }
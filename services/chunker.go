@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Silence is a stretch of audio that ffmpeg's silencedetect found quiet.
+type Silence struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Chunk is a slice of a longer audio file, transcribed on its own.
+type Chunk struct {
+	Start time.Duration
+	End   time.Duration
+	// Path is the chunk's audio file, once SplitAudio has written it.
+	Path string
+}
+
+// silencedetect settings: anything 30 dB below full scale for half a second
+// counts as a pause between sentences.
+const (
+	silenceNoise       = "-30dB"
+	silenceMinDuration = "0.5"
+)
+
+var (
+	silenceStartRe = regexp.MustCompile(`silence_start: (-?\d+(?:\.\d+)?)`)
+	silenceEndRe   = regexp.MustCompile(`silence_end: (\d+(?:\.\d+)?)`)
+)
+
+// DetectSilences runs ffmpeg's silencedetect filter over the audio file and
+// returns the silences it found, in order, along with the audio's duration.
+func DetectSilences(ctx context.Context, audioPath string) ([]Silence, time.Duration, error) {
+	filter := fmt.Sprintf("silencedetect=noise=%s:d=%s", silenceNoise, silenceMinDuration)
+	cmd := execCommand("ffmpeg", "-nostats", "-i", audioPath, "-af", filter, "-f", "null", "-")
+	output, err := runCommand(ctx, cmd, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ffmpeg silencedetect failed: %v, output: %s", err, string(output))
+	}
+	silences, duration := parseSilences(string(output))
+	if duration == 0 {
+		return nil, 0, fmt.Errorf("could not read the duration of %s", filepath.Base(audioPath))
+	}
+	return silences, duration, nil
+}
+
+func parseSilences(output string) ([]Silence, time.Duration) {
+	var duration time.Duration
+	var silences []Silence
+	open := false
+	for _, line := range strings.Split(output, "\n") {
+		if duration == 0 {
+			if m := ffmpegDurationRe.FindStringSubmatch(line); m != nil {
+				duration, _ = ParseTimestamp(m[1])
+			}
+		}
+		if m := silenceStartRe.FindStringSubmatch(line); m != nil {
+			seconds, _ := strconv.ParseFloat(m[1], 64)
+			silences = append(silences, Silence{Start: secondsToDuration(max(seconds, 0))})
+			open = true
+		}
+		if m := silenceEndRe.FindStringSubmatch(line); m != nil && open {
+			seconds, _ := strconv.ParseFloat(m[1], 64)
+			silences[len(silences)-1].End = secondsToDuration(seconds)
+			open = false
+		}
+	}
+	// Silence that runs to the end of the file has no end line
+	if open {
+		silences[len(silences)-1].End = duration
+	}
+	return silences, duration
+}
+
+// PlanChunks divides duration into chunks of at most maxLen. Each cut is
+// placed in the middle of the latest silence in the second half of the
+// chunk, so words aren't split; without one the chunk is cut at maxLen.
+func PlanChunks(duration time.Duration, silences []Silence, maxLen time.Duration) []Chunk {
+	if maxLen <= 0 {
+		return []Chunk{{Start: 0, End: duration}}
+	}
+	var chunks []Chunk
+	start := time.Duration(0)
+	for duration-start > maxLen {
+		limit := start + maxLen
+		cut := limit
+		for _, s := range silences {
+			mid := (s.Start + s.End) / 2
+			if mid > start+maxLen/2 && mid <= limit {
+				cut = mid
+			}
+		}
+		chunks = append(chunks, Chunk{Start: start, End: cut})
+		start = cut
+	}
+	return append(chunks, Chunk{Start: start, End: duration})
+}
+
+// SplitAudio writes each chunk of the audio file to dir and sets its Path.
+// The audio is copied, not re-encoded.
+func SplitAudio(ctx context.Context, audioPath string, chunks []Chunk, dir string) error {
+	for i := range chunks {
+		c := &chunks[i]
+		c.Path = filepath.Join(dir, fmt.Sprintf("chunk%03d%s", i, filepath.Ext(audioPath)))
+		cmd := execCommand("ffmpeg", "-y", "-nostats",
+			"-ss", formatSeconds(c.Start), "-t", formatSeconds(c.End-c.Start),
+			"-i", audioPath, "-c", "copy", c.Path)
+		if output, err := runCommand(ctx, cmd, nil); err != nil {
+			return fmt.Errorf("ffmpeg failed to split chunk %d: %v, output: %s", i+1, err, string(output))
+		}
+	}
+	return nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// ChunkOptions tune TranscribeChunked.
+type ChunkOptions struct {
+	// MaxBytes is the largest file transcribe accepts. Bigger files are
+	// split into chunks that each fit.
+	MaxBytes int64
+	// Parallelism is how many chunks are transcribed at the same time.
+	Parallelism int
+	// Progress, if set, is told how far into the audio the finished chunks
+	// reach.
+	Progress func(position time.Duration)
+}
+
+// TranscribeChunked transcribes audioPath with transcribe, first splitting
+// it at silences if it is larger than opts.MaxBytes. The chunks' segments
+// are shifted back onto the original timeline and joined in order.
+func TranscribeChunked(ctx context.Context, audioPath string, opts ChunkOptions, transcribe func(ctx context.Context, path string) (*Transcript, error)) (*Transcript, error) {
+	info, err := os.Stat(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxBytes <= 0 || info.Size() <= opts.MaxBytes {
+		return transcribe(ctx, audioPath)
+	}
+
+	silences, duration, err := DetectSilences(ctx, audioPath)
+	if err != nil {
+		return nil, err
+	}
+	// Leave room for bitrate peaks and container overhead
+	bytesPerSecond := float64(info.Size()) / duration.Seconds()
+	maxLen := time.Duration(float64(opts.MaxBytes) * 0.9 / bytesPerSecond * float64(time.Second))
+	chunks := PlanChunks(duration, silences, maxLen)
+
+	dir, err := os.MkdirTemp("", "chunks-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := SplitAudio(ctx, audioPath, chunks, dir); err != nil {
+		return nil, err
+	}
+
+	results, err := transcribeChunks(ctx, chunks, opts, transcribe)
+	if err != nil {
+		return nil, err
+	}
+
+	stitched := &Transcript{Language: results[0].Language}
+	for i, t := range results {
+		offset := chunks[i].Start
+		for _, seg := range t.Segments {
+			seg.Shift(offset)
+			stitched.Segments = append(stitched.Segments, seg)
+		}
+	}
+	return stitched, nil
+}
+
+// transcribeChunks runs transcribe on every chunk, at most
+// opts.Parallelism at a time. The first failure cancels the rest.
+func transcribeChunks(ctx context.Context, chunks []Chunk, opts ChunkOptions, transcribe func(ctx context.Context, path string) (*Transcript, error)) ([]*Transcript, error) {
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*Transcript, len(chunks))
+	sem := make(chan struct{}, parallelism)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		done     time.Duration
+	)
+	for i, c := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			t, err := transcribe(ctx, c.Path)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("chunk %d of %d: %w", i+1, len(chunks), err)
+					cancel()
+				}
+				return
+			}
+			results[i] = t
+			// Chunks finish out of order, so this is the total transcribed
+			// rather than a position
+			done += c.End - c.Start
+			if opts.Progress != nil {
+				opts.Progress(done)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	for _, t := range results {
+		if t == nil {
+			// Only skipped when the caller's context was cancelled
+			return nil, context.Cause(ctx)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSilences(t *testing.T) {
+	output := strings.Join([]string{
+		"Input #0, wav, from 'audio.wav':",
+		"  Duration: 00:01:00.00, bitrate: 256 kb/s",
+		"[silencedetect @ 0x55] silence_start: -0.012",
+		"[silencedetect @ 0x55] silence_end: 1.5 | silence_duration: 1.512",
+		"[silencedetect @ 0x55] silence_start: 30.25",
+		"[silencedetect @ 0x55] silence_end: 31 | silence_duration: 0.75",
+		"[silencedetect @ 0x55] silence_start: 58",
+	}, "\n")
+
+	silences, duration := parseSilences(output)
+	if duration != time.Minute {
+		t.Errorf("Expected duration 1m, got %v", duration)
+	}
+	want := []Silence{
+		{0, 1500 * time.Millisecond},
+		{30250 * time.Millisecond, 31 * time.Second},
+		{58 * time.Second, time.Minute},
+	}
+	if len(silences) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, silences)
+	}
+	for i := range want {
+		if silences[i] != want[i] {
+			t.Errorf("Silence %d: expected %v, got %v", i, want[i], silences[i])
+		}
+	}
+}
+
+func TestPlanChunks(t *testing.T) {
+	s := time.Second
+	tests := []struct {
+		name     string
+		duration time.Duration
+		silences []Silence
+		maxLen   time.Duration
+		want     []Chunk
+	}{
+		{
+			name:     "Fits in one chunk",
+			duration: 10 * s,
+			maxLen:   20 * s,
+			want:     []Chunk{{Start: 0, End: 10 * s}},
+		},
+		{
+			name:     "Cut in the latest silence",
+			duration: 25 * s,
+			silences: []Silence{{6 * s, 7 * s}, {8 * s, 9 * s}, {17 * s, 19 * s}},
+			maxLen:   10 * s,
+			want:     []Chunk{{Start: 0, End: 8500 * time.Millisecond}, {Start: 8500 * time.Millisecond, End: 18 * s}, {Start: 18 * s, End: 25 * s}},
+		},
+		{
+			name:     "Hard cut without silence",
+			duration: 25 * s,
+			silences: []Silence{{1 * s, 2 * s}},
+			maxLen:   10 * s,
+			want:     []Chunk{{Start: 0, End: 10 * s}, {Start: 10 * s, End: 20 * s}, {Start: 20 * s, End: 25 * s}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PlanChunks(tt.duration, tt.silences, tt.maxLen)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("Chunk %d: expected %v, got %v", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func writeTestAudio(t *testing.T, size int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audio.ogg")
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTranscribeChunked(t *testing.T) {
+	mockFFmpeg(t)
+	// 10 s of audio at 100 bytes a second, so 300 bytes hold 2.7 s
+	audioPath := writeTestAudio(t, 1000)
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var progress []time.Duration
+	opts := ChunkOptions{
+		MaxBytes:    300,
+		Parallelism: 2,
+		Progress: func(position time.Duration) {
+			progress = append(progress, position)
+		},
+	}
+	transcript, err := TranscribeChunked(context.Background(), audioPath, opts, func(ctx context.Context, path string) (*Transcript, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		return &Transcript{Segments: []Segment{{Start: 100 * time.Millisecond, End: time.Second, Text: name}}}, nil
+	})
+	if err != nil {
+		t.Fatalf("TranscribeChunked failed: %v", err)
+	}
+
+	// Chunks are cut at 2.2 s and 4.7 s, in the detected silences, then hard
+	// at 7.4 s
+	wantStarts := []time.Duration{100 * time.Millisecond, 2300 * time.Millisecond, 4800 * time.Millisecond, 7500 * time.Millisecond}
+	if len(transcript.Segments) != len(wantStarts) {
+		t.Fatalf("Expected %d segments, got %+v", len(wantStarts), transcript.Segments)
+	}
+	for i, seg := range transcript.Segments {
+		if seg.Start != wantStarts[i] {
+			t.Errorf("Segment %d: expected start %v, got %v", i, wantStarts[i], seg.Start)
+		}
+		if want := "chunk00" + string(rune('0'+i)); seg.Text != want {
+			t.Errorf("Segment %d: expected text %q, got %q", i, want, seg.Text)
+		}
+	}
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 chunks at a time, got %d", maxRunning)
+	}
+	if len(progress) != 4 || progress[3] != 10*time.Second {
+		t.Errorf("Expected progress to reach 10s in 4 steps, got %v", progress)
+	}
+}
+
+func TestTranscribeChunkedSmallFile(t *testing.T) {
+	_, runs := mockFFmpeg(t)
+	audioPath := writeTestAudio(t, 100)
+
+	var paths []string
+	_, err := TranscribeChunked(context.Background(), audioPath, ChunkOptions{MaxBytes: 300}, func(ctx context.Context, path string) (*Transcript, error) {
+		paths = append(paths, path)
+		return &Transcript{}, nil
+	})
+	if err != nil {
+		t.Fatalf("TranscribeChunked failed: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != audioPath || *runs != 0 {
+		t.Errorf("Expected the file to be sent whole without ffmpeg, got %v after %d runs", paths, *runs)
+	}
+}
+
+func TestTranscribeChunkedError(t *testing.T) {
+	mockFFmpeg(t)
+	audioPath := writeTestAudio(t, 1000)
+
+	failure := errors.New("rate limited")
+	_, err := TranscribeChunked(context.Background(), audioPath, ChunkOptions{MaxBytes: 300, Parallelism: 1}, func(ctx context.Context, path string) (*Transcript, error) {
+		if strings.Contains(path, "chunk001") {
+			return nil, failure
+		}
+		return &Transcript{}, ctx.Err()
+	})
+	if err == nil || !strings.Contains(err.Error(), "chunk 2 of 4: rate limited") {
+		t.Errorf("Expected the failing chunk's error, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeFailures are the failures the fake backend can be told to produce.
+// The API ones are the typed errors a real API returns, so the job page's
+// advice for them can be tried out.
+var FakeFailures = map[string]error{
+	"error":      errors.New("fake transcription failed"),
+	"auth":       &APIError{Status: 401, Message: "Incorrect API key provided", Code: "invalid_api_key", Kind: ErrAPIAuth},
+	"quota":      &APIError{Status: 429, Message: "You exceeded your current quota", Code: "insufficient_quota", Kind: ErrAPIQuota},
+	"rate-limit": &APIError{Status: 429, Message: "Rate limit reached", Kind: ErrAPIRateLimited},
+	"too-large":  &APIError{Status: 413, Message: "Maximum content size limit exceeded", Kind: ErrAPITooLarge},
+	"server":     &APIError{Status: 503, Message: "Service Unavailable", Kind: ErrAPIServer},
+}
+
+// fakeSegmentLength is how much audio each generated segment covers.
+const fakeSegmentLength = 4 * time.Second
+
+// fakeDefaultDuration stands in for the length of audio that isn't a WAV
+// file, such as the placeholder a mocked ffmpeg writes.
+const fakeDefaultDuration = 30 * time.Second
+
+// Fake is a Transcriber that needs neither whisper nor a network, for
+// developing and testing the UI, job queue and exports. It returns scripted
+// segments, or numbered ones spread over the audio, after a set delay, and
+// can be made to fail. Apart from FailEvery, its output depends only on the
+// audio and options.
+type Fake struct {
+	// Script is returned for every job when set, e.g. from LoadFakeScript.
+	// Nil generates a segment every four seconds of audio.
+	Script *Transcript
+	// Latency is how long each transcription takes, with progress reported
+	// along the way.
+	Latency time.Duration
+	// Failure names one of FakeFailures to return half way through
+	// instead of a transcript. Empty never fails.
+	Failure string
+	// FailEvery makes only every nth job fail, so retries can succeed. 0 or
+	// 1 fails every job.
+	FailEvery int
+
+	mu   sync.Mutex
+	runs int
+}
+
+func (*Fake) Name() string        { return "fake" }
+func (*Fake) Description() string { return "Fake transcriber" }
+
+func (*Fake) Capabilities() Capabilities {
+	return Capabilities{Timestamps: true, WordTimings: true, Audio: ProfileWAV}
+}
+
+// LoadFakeScript reads the transcript the fake backend returns from an SRT
+// file or a whisper JSON result.
+func LoadFakeScript(path string) (*Transcript, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".srt":
+		segments, err := ParseSRT(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid script %s: %v", path, err)
+		}
+		return &Transcript{Segments: segments}, nil
+	case ".json":
+		result, err := ParseWhisperJSON(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid script %s: %v", path, err)
+		}
+		return result.Transcript(), nil
+	default:
+		return nil, fmt.Errorf("script %s must be .srt or whisper .json", path)
+	}
+}
+
+func (f *Fake) Transcribe(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	duration, err := wavDuration(audioPath)
+	if err != nil {
+		if _, statErr := os.Stat(audioPath); statErr != nil {
+			return nil, statErr
+		}
+		duration = fakeDefaultDuration
+	}
+	var failure error
+	if f.Failure != "" {
+		var ok bool
+		if failure, ok = FakeFailures[f.Failure]; !ok {
+			return nil, fmt.Errorf("unknown fake failure %q", f.Failure)
+		}
+		if !f.failsThisRun() {
+			failure = nil
+		}
+	}
+
+	// The delay is spent in ten steps, reporting progress after each
+	const steps = 10
+	for i := 1; i <= steps; i++ {
+		if failure != nil && i > steps/2 {
+			return nil, failure
+		}
+		if err := sleepContext(ctx, f.Latency/steps); err != nil {
+			return nil, err
+		}
+		if opts.Progress != nil {
+			opts.Progress(duration * time.Duration(i) / steps)
+		}
+	}
+
+	var transcript *Transcript
+	if f.Script != nil {
+		transcript = copyTranscript(f.Script)
+	} else {
+		transcript = fakeTranscript(duration)
+	}
+	if opts.Language != "" {
+		transcript.Language = opts.Language
+	} else if transcript.Language == "" {
+		transcript.Language = "en"
+	}
+	return transcript, nil
+}
+
+// failsThisRun counts the run and reports whether it is one of the
+// FailEvery that fail.
+func (f *Fake) failsThisRun() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runs++
+	return f.FailEvery <= 1 || f.runs%f.FailEvery == 0
+}
+
+// fakeTranscript numbers a segment for every fakeSegmentLength of audio,
+// with its words spread evenly over it.
+func fakeTranscript(duration time.Duration) *Transcript {
+	t := &Transcript{}
+	for n, start := 1, time.Duration(0); start < duration; n, start = n+1, start+fakeSegmentLength {
+		end := min(start+fakeSegmentLength, duration)
+		seg := Segment{Start: start, End: end, Text: fmt.Sprintf("This is fake segment number %d.", n)}
+		words := strings.Fields(seg.Text)
+		at := func(i int) time.Duration {
+			return start + (end-start)*time.Duration(i)/time.Duration(len(words))
+		}
+		for i, word := range words {
+			seg.Words = append(seg.Words, Word{Start: at(i), End: at(i + 1), Text: word})
+		}
+		t.Segments = append(t.Segments, seg)
+	}
+	return t
+}
+
+// copyTranscript copies t deeply enough that callers can shift its times.
+func copyTranscript(t *Transcript) *Transcript {
+	c := &Transcript{Language: t.Language, Segments: make([]Segment, len(t.Segments))}
+	for i, seg := range t.Segments {
+		seg.Words = append([]Word(nil), seg.Words...)
+		c.Segments[i] = seg
+	}
+	return c
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakeGenerated(t *testing.T) {
+	audio := writeTestWAV(t, toneSpan{10 * time.Second, 0, false})
+	f := &Fake{Latency: 20 * time.Millisecond}
+
+	var positions []time.Duration
+	transcript, err := f.Transcribe(context.Background(), audio, TranscribeOptions{
+		Progress: func(position time.Duration) { positions = append(positions, position) },
+	})
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+
+	// A segment per four seconds, the last one cut short by the audio's end
+	if len(transcript.Segments) != 3 {
+		t.Fatalf("Expected 3 segments, got %+v", transcript.Segments)
+	}
+	last := transcript.Segments[2]
+	if last.Start != 8*time.Second || last.End != 10*time.Second || last.Text != "This is fake segment number 3." {
+		t.Errorf("Unexpected last segment %+v", last)
+	}
+	if len(last.Words) != 6 || last.Words[5].End != 10*time.Second {
+		t.Errorf("Expected 6 words ending with the segment, got %+v", last.Words)
+	}
+	if transcript.Language != "en" {
+		t.Errorf("Expected language en, got %q", transcript.Language)
+	}
+	if len(positions) != 10 || positions[9] != 10*time.Second {
+		t.Errorf("Expected 10 progress steps up to 10s, got %v", positions)
+	}
+
+	// The same audio gives the same transcript
+	again, err := f.Transcribe(context.Background(), audio, TranscribeOptions{})
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	if !reflect.DeepEqual(again, transcript) {
+		t.Errorf("Expected the same transcript twice, got %+v and %+v", transcript, again)
+	}
+}
+
+func TestFakeScript(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.srt")
+	srt := "1\n00:00:01,000 --> 00:00:02,500\nHallo\n\n2\n00:00:03,000 --> 00:00:04,000\nWelt\n\n"
+	if err := os.WriteFile(script, []byte(srt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFakeScript(script)
+	if err != nil {
+		t.Fatalf("LoadFakeScript failed: %v", err)
+	}
+
+	// Not a WAV, as when ffmpeg is mocked
+	audio := filepath.Join(dir, "audio.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := &Fake{Script: loaded}
+	transcript, err := f.Transcribe(context.Background(), audio, TranscribeOptions{Language: "de"})
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	want := []Segment{
+		{Start: time.Second, End: 2500 * time.Millisecond, Text: "Hallo"},
+		{Start: 3 * time.Second, End: 4 * time.Second, Text: "Welt"},
+	}
+	if !reflect.DeepEqual(transcript.Segments, want) || transcript.Language != "de" {
+		t.Errorf("Expected the script in German, got %+v", transcript)
+	}
+
+	// Callers may change what they get back without changing the script
+	transcript.Segments[0].Shift(time.Minute)
+	if loaded.Segments[0].Start != time.Second {
+		t.Error("Expected the script to be copied")
+	}
+
+	if _, err := LoadFakeScript(filepath.Join(dir, "script.txt")); err == nil {
+		t.Error("Expected an error for a script that is neither SRT nor JSON")
+	}
+}
+
+func TestFakeFailures(t *testing.T) {
+	audio := writeTestWAV(t, toneSpan{time.Second, 0, false})
+	f := &Fake{Failure: "quota", FailEvery: 2}
+
+	var failed []bool
+	var positions int
+	for range 4 {
+		_, err := f.Transcribe(context.Background(), audio, TranscribeOptions{
+			Progress: func(time.Duration) { positions++ },
+		})
+		if err != nil && !errors.Is(err, ErrAPIQuota) {
+			t.Fatalf("Expected a quota error, got %v", err)
+		}
+		failed = append(failed, err != nil)
+	}
+	if want := []bool{false, true, false, true}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("Expected every second run to fail, got %v", failed)
+	}
+	// Failing runs get half way first
+	if positions != 10+5+10+5 {
+		t.Errorf("Expected 30 progress reports, got %d", positions)
+	}
+
+	if _, err := (&Fake{Failure: "gremlins"}).Transcribe(context.Background(), audio, TranscribeOptions{}); err == nil {
+		t.Error("Expected an error for an unknown failure")
+	}
+}
+
+func TestFakeCancel(t *testing.T) {
+	audio := writeTestWAV(t, toneSpan{time.Second, 0, false})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (&Fake{Latency: time.Hour}).Transcribe(ctx, audio, TranscribeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancellation, got %v", err)
+	}
+}
+
+func TestFakeJobQueue(t *testing.T) {
+	audio := writeTestWAV(t, toneSpan{6 * time.Second, 0, false})
+	f := &Fake{Latency: 10 * time.Millisecond}
+	run := func(ctx context.Context, job *Job, report *JobReporter) (*Transcript, error) {
+		report.SetState(JobTranscribing)
+		return f.Transcribe(ctx, audio, TranscribeOptions{
+			Progress: func(position time.Duration) { report.Progress(position, 6*time.Second) },
+		})
+	}
+	q := NewJobQueue(NewMemoryJobStore(), 1, run)
+	defer q.Close()
+
+	job, err := q.Submit(&Job{VideoPath: "video.mp4", Backend: f.Name()})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	done := waitForJob(t, q, job.ID)
+	if done.State != JobDone || len(done.Transcript.Segments) != 2 {
+		t.Errorf("Expected a done job with 2 segments, got %s %+v", done.State, done.Transcript)
+	}
+}
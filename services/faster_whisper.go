@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FasterWhisperModels are the model sizes faster-whisper downloads by name,
+// from fastest to most accurate.
+var FasterWhisperModels = []string{"tiny", "base", "small", "medium", "large-v3", "distil-large-v3"}
+
+// FasterWhisperComputeTypes are the CTranslate2 precisions jobs can pick.
+// int8 is the quickest on CPUs; float16 needs a GPU.
+var FasterWhisperComputeTypes = []string{"int8", "int8_float16", "float16", "float32"}
+
+// FasterWhisper is the Transcriber backed by faster-whisper, the CTranslate2
+// port of whisper, through the whisper-ctranslate2 CLI. That CLI takes the
+// same arguments and writes the same JSON as the whisper CLI, so a wrapper
+// script around faster-whisper that does too works as well.
+type FasterWhisper struct {
+	// Binary is the CLI. Empty looks for whisper-ctranslate2 in PATH.
+	Binary string
+	// DefaultModel is used for jobs that don't pick one. Empty leaves the
+	// CLI's default, small.
+	DefaultModel string
+	// ComputeType is used for jobs that don't pick one. Empty leaves the
+	// CLI's default for the device.
+	ComputeType string
+	// Device is cpu, cuda or empty for the CLI's choice.
+	Device string
+	// Threads is how many CPU threads the CLI uses. Zero leaves its default.
+	Threads int
+}
+
+func (FasterWhisper) Name() string        { return "faster-whisper" }
+func (FasterWhisper) Description() string { return "faster-whisper" }
+
+func (FasterWhisper) Capabilities() Capabilities {
+	return Capabilities{
+		Timestamps:   true,
+		WordTimings:  true,
+		Audio:        ProfileWAV,
+		Models:       FasterWhisperModels,
+		ComputeTypes: FasterWhisperComputeTypes,
+	}
+}
+
+func (f FasterWhisper) binary() (string, error) {
+	if f.Binary != "" {
+		return f.Binary, nil
+	}
+	path, err := execLookPath("whisper-ctranslate2")
+	if err != nil {
+		return "", errors.New("whisper-ctranslate2 not found in PATH, install it with 'pip install whisper-ctranslate2' or set FASTER_WHISPER_BIN")
+	}
+	return path, nil
+}
+
+// CheckTool reports the CLI's path and version.
+func (f FasterWhisper) CheckTool() ToolCheck {
+	check := ToolCheck{Name: "faster-whisper"}
+	check.Path, check.Err = f.binary()
+	if check.Err == nil {
+		check.Version, check.Err = toolVersion([]string{check.Path, "--version"})
+	}
+	return check
+}
+
+func (f FasterWhisper) Transcribe(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	binary, err := f.binary()
+	if err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp("", "faster_whisper_output")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// whisper-ctranslate2 <audioPath> --output_format json --word_timestamps True --output_dir <tempDir> --verbose True
+	//     [--model M] [--compute_type T] [--beam_size N] [--device D] [--threads N] [--language=L] ...
+	// User text is joined to its flag, so a prompt starting with '-' isn't
+	// taken for an option
+	args := []string{audioPath, "--output_format", "json", "--word_timestamps", "True",
+		"--output_dir", tempDir, "--verbose", "True"}
+	model := opts.Model
+	if model == "" {
+		model = f.DefaultModel
+	}
+	if model != "" {
+		args = append(args, "--model", model)
+	}
+	computeType := opts.ComputeType
+	if computeType == "" {
+		computeType = f.ComputeType
+	}
+	if computeType != "" {
+		args = append(args, "--compute_type", computeType)
+	}
+	if opts.BeamSize > 0 {
+		args = append(args, "--beam_size", strconv.Itoa(opts.BeamSize))
+	}
+	if f.Device != "" {
+		args = append(args, "--device", f.Device)
+	}
+	if f.Threads > 0 {
+		args = append(args, "--threads", strconv.Itoa(f.Threads))
+	}
+	if opts.Language != "" {
+		args = append(args, "--language="+opts.Language)
+	}
+	if opts.Prompt != "" {
+		args = append(args, "--initial_prompt="+opts.Prompt)
+	}
+	if opts.Temperature > 0 {
+		args = append(args, "--temperature", strconv.FormatFloat(opts.Temperature, 'f', -1, 64))
+	}
+	cmd := execCommand(binary, args...)
+	cmd.Env = append(cmd.Environ(), "PYTHONUNBUFFERED=1")
+
+	// Verbose output has the same per-segment lines as whisper's
+	var onLine func(string)
+	if opts.Progress != nil {
+		onLine = func(line string) {
+			if position, ok := parseWhisperProgress(line); ok {
+				opts.Progress(position)
+			}
+		}
+	}
+
+	output, err := runCommand(ctx, cmd, onLine)
+	if err != nil {
+		return nil, fmt.Errorf("faster-whisper failed: %v\nOutput: %s", err, string(output))
+	}
+	return readWhisperOutput(tempDir, output)
+}
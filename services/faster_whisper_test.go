@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFasterWhisper(t *testing.T) {
+	var args []string
+	mockWhisperCLI(t, &args)
+	audio := filepath.Join(t.TempDir(), "audio.wav")
+	if err := os.WriteFile(audio, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := FasterWhisper{Binary: "/opt/venv/bin/whisper-ctranslate2", ComputeType: "int8", Threads: 4}
+	var positions []time.Duration
+	transcript, err := f.Transcribe(context.Background(), audio, TranscribeOptions{
+		Model:       "medium",
+		ComputeType: "float32",
+		BeamSize:    2,
+		Language:    "de",
+		Prompt:      "-Alice, Bob",
+		Progress:    func(position time.Duration) { positions = append(positions, position) },
+	})
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+
+	if text := transcript.Text(); text != "Transcribed text" {
+		t.Errorf("Expected 'Transcribed text', got '%s'", text)
+	}
+	if words := transcript.Segments[0].Words; len(words) != 1 || words[0].Probability != 0.93 {
+		t.Errorf("Expected the word timings, got %+v", words)
+	}
+	if len(positions) != 2 || positions[1] != 3*time.Second {
+		t.Errorf("Expected progress [1.5s 3s], got %v", positions)
+	}
+
+	// The job's choices override the backend's defaults
+	command := strings.Join(args, " ")
+	for _, want := range []string{"--model medium", "--compute_type float32", "--beam_size 2", "--threads 4"} {
+		if !strings.Contains(command, want) {
+			t.Errorf("Expected %q in %q", want, command)
+		}
+	}
+	// A prompt starting with a dash must not be parsed as an option
+	for _, want := range []string{"--language=de", "--initial_prompt=-Alice, Bob"} {
+		if !slices.Contains(args, want) {
+			t.Errorf("Expected argument %q, got %q", want, args)
+		}
+	}
+}
+
+func TestFasterWhisperDefaults(t *testing.T) {
+	var args []string
+	mockWhisperCLI(t, &args)
+	execLookPath = func(file string) (string, error) {
+		return "/usr/local/bin/" + file, nil
+	}
+	defer func() { execLookPath = exec.LookPath }()
+	audio := filepath.Join(t.TempDir(), "audio.wav")
+	if err := os.WriteFile(audio, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := FasterWhisper{DefaultModel: "small", ComputeType: "int8"}
+	if _, err := f.Transcribe(context.Background(), audio, TranscribeOptions{}); err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	command := strings.Join(args, " ")
+	for _, want := range []string{"/usr/local/bin/whisper-ctranslate2 ", "--model small", "--compute_type int8"} {
+		if !strings.Contains(command, want) {
+			t.Errorf("Expected %q in %q", want, command)
+		}
+	}
+	if strings.Contains(command, "--beam_size") {
+		t.Errorf("Expected the CLI's default beam size, got %q", command)
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// FilterPreset is a named ffmpeg audio filter chain applied while
+// extracting audio, to clean it up for whisper.
+type FilterPreset struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Filters are ffmpeg -af filters, applied in order.
+	Filters []string `json:"filters"`
+}
+
+// Chain is the preset's filters joined into one -af argument.
+func (p FilterPreset) Chain() string {
+	return strings.Join(p.Filters, ",")
+}
+
+// loudnorm targets the EBU R128 broadcast loudness, which lifts quiet
+// recordings without clipping loud ones.
+const loudnorm = "loudnorm=I=-16:TP=-1.5:LRA=11"
+
+// FilterPresets are the filter chains users can pick for a job.
+var FilterPresets = []FilterPreset{
+	{
+		Name:        "normalize",
+		Description: "Normalize loudness",
+		Filters:     []string{loudnorm},
+	},
+	{
+		Name:        "voice",
+		Description: "Voice band and normalize",
+		// Speech sits between roughly 80 Hz and 8 kHz; rumble and hiss
+		// outside it only confuse the model
+		Filters: []string{"highpass=f=80", "lowpass=f=8000", loudnorm},
+	},
+	{
+		Name:        "denoise",
+		Description: "Denoise, voice band and normalize",
+		// Denoise before normalizing, or the noise is made louder too
+		Filters: []string{"highpass=f=80", "lowpass=f=8000", "afftdn=nf=-25", loudnorm},
+	},
+}
+
+// GetFilterPreset looks up a preset by name.
+func GetFilterPreset(name string) (FilterPreset, error) {
+	for _, p := range FilterPresets {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return FilterPreset{}, fmt.Errorf("unknown audio filter %q", name)
+}
+
+// filterKey is a short hash of a filter chain, to tell apart audio extracted
+// with different filters.
+func filterKey(filters []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(filters, ",")))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,27 @@
+package services
+
+import "testing"
+
+func TestGetFilterPreset(t *testing.T) {
+	preset, err := GetFilterPreset("denoise")
+	if err != nil {
+		t.Fatalf("GetFilterPreset failed: %v", err)
+	}
+	if want := "highpass=f=80,lowpass=f=8000,afftdn=nf=-25," + loudnorm; preset.Chain() != want {
+		t.Errorf("Expected chain %q, got %q", want, preset.Chain())
+	}
+	if _, err := GetFilterPreset("louder"); err == nil {
+		t.Error("Expected an error for an unknown preset")
+	}
+}
+
+func TestFilterKey(t *testing.T) {
+	voice, _ := GetFilterPreset("voice")
+	denoise, _ := GetFilterPreset("denoise")
+	if filterKey(voice.Filters) == filterKey(denoise.Filters) {
+		t.Error("Expected different chains to get different keys")
+	}
+	if filterKey(voice.Filters) != filterKey(append([]string(nil), voice.Filters...)) {
+		t.Error("Expected the same chain to get the same key")
+	}
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// JobState is the lifecycle stage of a transcription job.
+type JobState string
+
+const (
+	JobQueued       JobState = "queued"
+	JobExtracting   JobState = "extracting"
+	JobTranscribing JobState = "transcribing"
+	JobDone         JobState = "done"
+	JobFailed       JobState = "failed"
+)
+
+// Label is the user-facing name of the state.
+func (s JobState) Label() string {
+	switch s {
+	case JobQueued:
+		return "Queued"
+	case JobExtracting:
+		return "Extracting audio"
+	case JobTranscribing:
+		return "Transcribing"
+	case JobDone:
+		return "Done"
+	case JobFailed:
+		return "Failed"
+	}
+	return string(s)
+}
+
+// Job is one transcription request and its outcome.
+type Job struct {
+	ID        string `json:"id"`
+	MediaID   string `json:"mediaId"`
+	VideoPath string `json:"videoPath"`
+	// AudioStream is the audio track to transcribe, as an index into
+	// MediaInfo.Audio.
+	AudioStream int `json:"audioStream,omitempty"`
+	// SkipSilence transcribes only the stretches RemoveSilence finds speech
+	// in, so whisper doesn't hallucinate text over silence and music.
+	SkipSilence bool `json:"skipSilence,omitempty"`
+	// AudioFilter is a copy of the filter preset the audio was cleaned up
+	// with, kept whole so the job can be reproduced if the preset changes.
+	AudioFilter *FilterPreset `json:"audioFilter,omitempty"`
+	// Backend is the backend picked for the job, which may be AutoBackend.
+	Backend string `json:"backend"`
+	// Backends are the backends to try in order, as routed when the job was
+	// submitted. Jobs from before routing have none and use Backend.
+	Backends []string `json:"backends,omitempty"`
+	// TranscribedBy is the backend that produced the transcript, once the
+	// job is done.
+	TranscribedBy string            `json:"transcribedBy,omitempty"`
+	Options       TranscribeOptions `json:"options"`
+	State         JobState          `json:"state"`
+	// Error is set when State is JobFailed.
+	Error      string      `json:"error,omitempty"`
+	Transcript *Transcript `json:"transcript,omitempty"`
+	// Progress is live data for the running stage, kept by the JobQueue.
+	Progress  Progress  `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Finished reports whether the job has reached a terminal state.
+func (j *Job) Finished() bool {
+	return j.State == JobDone || j.State == JobFailed
+}
+
+// ErrJobNotFound is returned by a JobStore for unknown IDs.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobStore keeps jobs. Implementations must be safe for concurrent use and
+// must hand out copies, so callers can't mutate stored jobs in place.
+type JobStore interface {
+	CreateJob(job *Job) error
+	GetJob(id string) (*Job, error)
+	UpdateJob(job *Job) error
+}
+
+// MemoryJobStore is a JobStore that lives only as long as the process.
+type MemoryJobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]Job)}
+}
+
+func (s *MemoryJobStore) CreateJob(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.ID]; exists {
+		return fmt.Errorf("job %s already exists", job.ID)
+	}
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+func (s *MemoryJobStore) GetJob(id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+func (s *MemoryJobStore) UpdateJob(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.ID]; !ok {
+		return ErrJobNotFound
+	}
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+// JobFunc does the work for a job. It reports stage changes and progress
+// through report and returns the finished transcript.
+type JobFunc func(ctx context.Context, job *Job, report *JobReporter) (*Transcript, error)
+
+// JobReporter is handed to a running JobFunc to publish what it is doing.
+type JobReporter struct {
+	q          *JobQueue
+	id         string
+	stageStart time.Time
+	// duration is the last known media length, carried over between stages
+	// because only some tools print it.
+	duration time.Duration
+}
+
+// SetState moves the job to a new stage and resets its progress.
+func (r *JobReporter) SetState(state JobState) {
+	r.stageStart = time.Now()
+	r.q.setProgress(r.id, Progress{Duration: r.duration})
+	r.q.update(r.id, func(j *Job) { j.State = state })
+}
+
+// SetDuration seeds the media length, so progress has a percentage and an
+// ETA even when no tool prints it, as when the audio comes from the cache.
+func (r *JobReporter) SetDuration(d time.Duration) {
+	if d > 0 {
+		r.duration = d
+	}
+}
+
+// SetTranscribedBy records the backend that produced the job's transcript.
+func (r *JobReporter) SetTranscribedBy(backend string) {
+	r.q.update(r.id, func(j *Job) { j.TranscribedBy = backend })
+}
+
+// Progress records how far into the media the current stage is. A zero
+// total keeps the last known duration. It has the ProgressFunc signature.
+func (r *JobReporter) Progress(position, total time.Duration) {
+	if total > 0 {
+		r.duration = total
+	}
+	p := Progress{Position: position, Duration: r.duration}
+	if elapsed := time.Since(r.stageStart); position > 0 && p.Duration > position {
+		p.ETA = time.Duration(float64(elapsed) * float64(p.Duration-position) / float64(position))
+	}
+	r.q.setProgress(r.id, p)
+}
+
+// ErrQueueFull is returned by Submit when no more jobs can be buffered.
+var ErrQueueFull = errors.New("transcription queue is full, try again later")
+
+// JobQueue runs jobs on a fixed pool of workers.
+type JobQueue struct {
+	store   JobStore
+	run     JobFunc
+	pending chan string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	// mu guards the live state that is not worth persisting
+	mu       sync.Mutex
+	progress map[string]Progress
+	subs     map[string]map[chan struct{}]struct{}
+}
+
+// jobQueueSize is how many jobs can wait for a worker before Submit fails.
+const jobQueueSize = 100
+
+// NewJobQueue starts workers goroutines that take submitted jobs and pass
+// them to run.
+func NewJobQueue(store JobStore, workers int, run JobFunc) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &JobQueue{
+		store:    store,
+		run:      run,
+		pending:  make(chan string, jobQueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		progress: make(map[string]Progress),
+		subs:     make(map[string]map[chan struct{}]struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q
+}
+
+// Submit assigns the job an ID, stores it as queued and schedules it.
+func (q *JobQueue) Submit(job *Job) (*Job, error) {
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	job.ID = id
+	job.State = JobQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if err := q.store.CreateJob(job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case q.pending <- job.ID:
+		return job, nil
+	default:
+		q.fail(job.ID, ErrQueueFull)
+		return nil, ErrQueueFull
+	}
+}
+
+// Get returns the current state of a job, including live progress.
+func (q *JobQueue) Get(id string) (*Job, error) {
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	job.Progress = q.progress[id]
+	q.mu.Unlock()
+	return job, nil
+}
+
+// Subscribe returns a channel that receives a value whenever the job's state
+// or progress changes. Notifications are coalesced, so a slow reader only
+// sees that something changed and should Get the job again. The returned
+// func must be called to unsubscribe.
+func (q *JobQueue) Subscribe(id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	q.mu.Lock()
+	if q.subs[id] == nil {
+		q.subs[id] = make(map[chan struct{}]struct{})
+	}
+	q.subs[id][ch] = struct{}{}
+	q.mu.Unlock()
+
+	return ch, func() {
+		q.mu.Lock()
+		delete(q.subs[id], ch)
+		if len(q.subs[id]) == 0 {
+			delete(q.subs, id)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// Close stops the workers, cancelling any job that is running, and waits
+// for them to exit.
+func (q *JobQueue) Close() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+func (q *JobQueue) worker() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case id := <-q.pending:
+			q.process(id)
+		}
+	}
+}
+
+func (q *JobQueue) process(id string) {
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		log.Printf("Job %s vanished before it ran: %v", id, err)
+		return
+	}
+
+	report := &JobReporter{q: q, id: id, stageStart: time.Now()}
+	transcript, err := q.run(q.ctx, job, report)
+	if err != nil {
+		q.fail(id, err)
+		return
+	}
+	q.update(id, func(j *Job) {
+		j.State = JobDone
+		j.Transcript = transcript
+	})
+}
+
+func (q *JobQueue) fail(id string, err error) {
+	log.Printf("Job %s failed: %v", id, err)
+	q.update(id, func(j *Job) {
+		j.State = JobFailed
+		j.Error = err.Error()
+	})
+}
+
+func (q *JobQueue) update(id string, change func(*Job)) {
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		log.Printf("Failed to load job %s: %v", id, err)
+		return
+	}
+	change(job)
+	job.UpdatedAt = time.Now()
+	if err := q.store.UpdateJob(job); err != nil {
+		log.Printf("Failed to update job %s: %v", id, err)
+	}
+
+	if job.Finished() {
+		q.mu.Lock()
+		delete(q.progress, id)
+		q.mu.Unlock()
+	}
+	q.notify(id)
+}
+
+func (q *JobQueue) setProgress(id string, p Progress) {
+	q.mu.Lock()
+	q.progress[id] = p
+	q.mu.Unlock()
+	q.notify(id)
+}
+
+func (q *JobQueue) notify(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for ch := range q.subs[id] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A notification is already pending
+		}
+	}
+}
+
+// NewID returns a random 128-bit identifier in hex. IDs are unguessable, so
+// they are safe to hand to clients in URLs and forms.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForJob polls the queue until the job finishes or the test times out.
+func waitForJob(t *testing.T, q *JobQueue, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if job.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish in time", id)
+	return nil
+}
+
+func TestJobQueueRunsJobs(t *testing.T) {
+	var states []JobState
+	run := func(ctx context.Context, job *Job, report *JobReporter) (*Transcript, error) {
+		report.SetState(JobExtracting)
+		report.SetState(JobTranscribing)
+		states = append(states, JobExtracting, JobTranscribing)
+		return &Transcript{Segments: []Segment{{Text: job.VideoPath}}}, nil
+	}
+
+	q := NewJobQueue(NewMemoryJobStore(), 1, run)
+	defer q.Close()
+
+	job, err := q.Submit(&Job{VideoPath: "video.mp4", Backend: "local"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if len(job.ID) != 32 {
+		t.Errorf("Expected a 32 character hex ID, got %q", job.ID)
+	}
+	if job.State != JobQueued {
+		t.Errorf("Expected queued state, got %s", job.State)
+	}
+
+	done := waitForJob(t, q, job.ID)
+	if done.State != JobDone {
+		t.Fatalf("Expected done, got %s (%s)", done.State, done.Error)
+	}
+	if done.Transcript == nil || done.Transcript.Text() != "video.mp4" {
+		t.Errorf("Unexpected transcript %+v", done.Transcript)
+	}
+	if len(states) != 2 {
+		t.Errorf("Expected the job to pass through 2 stages, got %v", states)
+	}
+}
+
+func TestJobQueueRecordsFailure(t *testing.T) {
+	run := func(ctx context.Context, job *Job, report *JobReporter) (*Transcript, error) {
+		return nil, errors.New("whisper exploded")
+	}
+
+	q := NewJobQueue(NewMemoryJobStore(), 2, run)
+	defer q.Close()
+
+	job, err := q.Submit(&Job{VideoPath: "video.mp4"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	done := waitForJob(t, q, job.ID)
+	if done.State != JobFailed {
+		t.Fatalf("Expected failed, got %s", done.State)
+	}
+	if done.Error != "whisper exploded" {
+		t.Errorf("Unexpected error %q", done.Error)
+	}
+}
+
+func TestJobQueueCloseCancelsRunningJob(t *testing.T) {
+	started := make(chan struct{})
+	run := func(ctx context.Context, job *Job, report *JobReporter) (*Transcript, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	q := NewJobQueue(NewMemoryJobStore(), 1, run)
+	job, err := q.Submit(&Job{VideoPath: "video.mp4"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	<-started
+	q.Close()
+
+	got, err := q.Get(job.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.State != JobFailed {
+		t.Errorf("Expected cancelled job to be failed, got %s", got.State)
+	}
+}
+
+func TestMemoryJobStoreReturnsCopies(t *testing.T) {
+	store := NewMemoryJobStore()
+	if err := store.CreateJob(&Job{ID: "a", State: JobQueued}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateJob(&Job{ID: "a"}); err == nil {
+		t.Error("Expected error creating a duplicate job")
+	}
+
+	job, _ := store.GetJob("a")
+	job.State = JobDone
+	again, _ := store.GetJob("a")
+	if again.State != JobQueued {
+		t.Errorf("Mutating a returned job changed the store: %s", again.State)
+	}
+
+	if _, err := store.GetJob("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if err := store.UpdateJob(&Job{ID: "missing"}); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestJobQueueProgress(t *testing.T) {
+	reported := make(chan struct{})
+	release := make(chan struct{})
+	run := func(ctx context.Context, job *Job, report *JobReporter) (*Transcript, error) {
+		report.SetState(JobExtracting)
+		report.Progress(25*time.Second, 100*time.Second)
+		report.SetState(JobTranscribing)
+		// Whisper doesn't know the duration; it carries over from ffmpeg
+		report.Progress(50*time.Second, 0)
+		close(reported)
+		<-release
+		return &Transcript{}, nil
+	}
+
+	q := NewJobQueue(NewMemoryJobStore(), 1, run)
+	defer q.Close()
+
+	job, err := q.Submit(&Job{VideoPath: "video.mp4"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	updates, unsubscribe := q.Subscribe(job.ID)
+	defer unsubscribe()
+
+	<-reported
+	got, err := q.Get(job.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.State != JobTranscribing {
+		t.Errorf("Expected transcribing, got %s", got.State)
+	}
+	if got.Progress.Position != 50*time.Second || got.Progress.Duration != 100*time.Second {
+		t.Errorf("Unexpected progress %+v", got.Progress)
+	}
+	if got.Progress.ETA <= 0 {
+		t.Errorf("Expected an ETA, got %v", got.Progress.ETA)
+	}
+
+	select {
+	case <-updates:
+	default:
+		t.Error("Expected a pending update notification")
+	}
+
+	close(release)
+	done := waitForJob(t, q, job.ID)
+	if done.Progress != (Progress{}) {
+		t.Errorf("Expected progress to be cleared once done, got %+v", done.Progress)
+	}
+}
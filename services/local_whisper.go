@@ -1,57 +1,224 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 )
 
 var execLookPath = exec.LookPath
 
+// WhisperModels are the openai-whisper models jobs can pick, from fastest
+// to most accurate. The .en models are English-only but better at it.
+var WhisperModels = []string{"tiny", "tiny.en", "base", "base.en", "small", "small.en", "medium", "medium.en", "large", "turbo"}
+
+// defaultWhisperModel is the model used when neither the job nor the
+// server's configuration picks one.
+const defaultWhisperModel = "base"
+
+// LocalWhisper is the Transcriber backed by the openai-whisper CLI.
+type LocalWhisper struct {
+	// Command runs whisper, e.g. ["/opt/venv/bin/whisper"] or ["python3",
+	// "-m", "whisper"]. Empty looks for it with FindWhisper on each job.
+	Command []string
+	// DefaultModel is used for jobs that don't pick one. Empty means base.
+	DefaultModel string
+}
+
+func (LocalWhisper) Name() string        { return "local" }
+func (LocalWhisper) Description() string { return "Local Whisper CLI" }
+
+func (LocalWhisper) Capabilities() Capabilities {
+	return Capabilities{Timestamps: true, WordTimings: true, Audio: ProfileWAV, Models: WhisperModels}
+}
+
+func (l LocalWhisper) Transcribe(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.transcribe(ctx, audioPath, opts)
+}
+
 // TranscribeAudioLocal uses the local 'whisper' CLI tool to transcribe audio.
-func TranscribeAudioLocal(audioPath string) (string, error) {
-	// Check if whisper is installed
-	whisperCmd := "whisper"
-	if _, err := execLookPath(whisperCmd); err != nil {
-		// Fallback to common pip install location on Mac
-		fallbackPath := "/Users/dhch/Library/Python/3.9/bin/whisper"
-		if _, err := os.Stat(fallbackPath); err == nil {
-			whisperCmd = fallbackPath
-		} else {
-			return "", fmt.Errorf("whisper CLI tool not found in PATH or %s. Please ensure 'openai-whisper' is installed via pip", fallbackPath)
+func TranscribeAudioLocal(audioPath string) (*Transcript, error) {
+	return LocalWhisper{}.transcribe(context.Background(), audioPath, TranscribeOptions{})
+}
+
+// WhisperSearch says where FindWhisper looks for the whisper CLI.
+type WhisperSearch struct {
+	// Path is an explicit path to the CLI. If set, nowhere else is tried.
+	Path string
+	// Venv is a virtualenv with openai-whisper installed. Empty means the
+	// active one, $VIRTUAL_ENV, if any.
+	Venv string
+	// Python runs whisper as a module when there is no CLI script. Empty
+	// means python3.
+	Python string
+}
+
+// FindWhisper returns the command that runs whisper. It tries, in order,
+// an explicit path, the virtualenv's CLI, whisper in PATH, and finally
+// python -m whisper.
+func FindWhisper(s WhisperSearch) ([]string, error) {
+	if s.Path != "" {
+		path, err := execLookPath(s.Path)
+		if err != nil {
+			return nil, fmt.Errorf("whisper CLI %s not found: %v", s.Path, err)
+		}
+		return []string{path}, nil
+	}
+
+	var tried []string
+	venv := s.Venv
+	if venv == "" {
+		venv = os.Getenv("VIRTUAL_ENV")
+	}
+	if venv != "" {
+		path := filepath.Join(venv, "bin", "whisper")
+		if runtime.GOOS == "windows" {
+			path = filepath.Join(venv, "Scripts", "whisper.exe")
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return []string{path}, nil
+		}
+		tried = append(tried, path)
+	}
+	if path, err := execLookPath("whisper"); err == nil {
+		return []string{path}, nil
+	}
+	tried = append(tried, "whisper in PATH")
+
+	python := s.Python
+	if python == "" {
+		python = "python3"
+	}
+	if err := execCommand(python, "-c", "import whisper").Run(); err == nil {
+		return []string{python, "-m", "whisper"}, nil
+	}
+	tried = append(tried, python+" -m whisper")
+
+	return nil, fmt.Errorf("whisper CLI tool not found (tried %s). Please ensure 'openai-whisper' is installed via pip, or set WHISPER_BIN", strings.Join(tried, ", "))
+}
+
+func (l LocalWhisper) command() ([]string, error) {
+	if len(l.Command) > 0 {
+		return l.Command, nil
+	}
+	return FindWhisper(WhisperSearch{})
+}
+
+// whisperVersionScript prints the installed openai-whisper's version; the
+// CLI itself has no --version.
+const whisperVersionScript = "import importlib.metadata as m; print(m.version('openai-whisper'))"
+
+// CheckTool reports where whisper is and, if the Python running it can
+// tell, its version.
+func (l LocalWhisper) CheckTool() ToolCheck {
+	check := ToolCheck{Name: "whisper"}
+	command, err := l.command()
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	check.Path = strings.Join(command, " ")
+	python := command[0]
+	if len(command) == 1 {
+		python = scriptInterpreter(command[0])
+	}
+	if python != "" {
+		if version, err := toolVersion([]string{python, "-c", whisperVersionScript}); err == nil {
+			check.Version = "openai-whisper " + version
 		}
 	}
+	return check
+}
+
+func (l LocalWhisper) transcribe(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	command, err := l.command()
+	if err != nil {
+		return nil, err
+	}
+	model := opts.Model
+	if model == "" {
+		model = l.DefaultModel
+	}
+	if model == "" {
+		model = defaultWhisperModel
+	}
 
 	// Create a temporary directory for output
 	tempDir, err := os.MkdirTemp("", "whisper_output")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp dir: %v", err)
+		return nil, fmt.Errorf("failed to create temp dir: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
 
 	// Construct command
-	// whisper <audioPath> --model base --output_format txt --output_dir <tempDir>
-	cmd := execCommand(whisperCmd, audioPath, "--model", "base", "--output_format", "txt", "--output_dir", tempDir)
+	// whisper <audioPath> --model <model> --output_format json --word_timestamps True --output_dir <tempDir> --verbose True [--language=<lang>]
+	// Only the JSON output carries word timings. Verbose mode prints each
+	// segment as it is decoded, which drives progress. User text is joined
+	// to its flag, so a prompt starting with '-' isn't taken for an option
+	args := []string{audioPath, "--model", model, "--output_format", "json", "--word_timestamps", "True",
+		"--output_dir", tempDir, "--verbose", "True"}
+	if opts.Language != "" {
+		args = append(args, "--language="+opts.Language)
+	}
+	if opts.Prompt != "" {
+		args = append(args, "--initial_prompt="+opts.Prompt)
+	}
+	if opts.Temperature > 0 {
+		args = append(args, "--temperature", strconv.FormatFloat(opts.Temperature, 'f', -1, 64))
+	}
+	if opts.BeamSize > 0 {
+		args = append(args, "--beam_size", strconv.Itoa(opts.BeamSize))
+	}
+	cmd := execCommand(command[0], slices.Concat(command[1:], args)...)
+	// Python buffers stdout when it is a pipe, which would hold back progress
+	cmd.Env = append(cmd.Environ(), "PYTHONUNBUFFERED=1")
+
+	var onLine func(string)
+	if opts.Progress != nil {
+		onLine = func(line string) {
+			if position, ok := parseWhisperProgress(line); ok {
+				opts.Progress(position)
+			}
+		}
+	}
 
 	// Capture output for debugging
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(ctx, cmd, onLine)
 	if err != nil {
-		return "", fmt.Errorf("whisper command failed: %v\nOutput: %s", err, string(output))
+		return nil, fmt.Errorf("whisper command failed: %v\nOutput: %s", err, string(output))
 	}
 
-	// Read the output file
-	// Whisper creates a file with the same basename as the audio file but with .txt extension
-	baseName := filepath.Base(audioPath)
-	// Remove extension from baseName to get the name whisper uses
-	fileNameWithoutExt := strings.TrimSuffix(baseName, filepath.Ext(baseName))
-	outputFilePath := filepath.Join(tempDir, fileNameWithoutExt+".txt")
+	return readWhisperOutput(tempDir, output)
+}
+
+// readWhisperOutput parses the JSON result a whisper-style CLI wrote to
+// dir. The output dir is ours alone, so whatever JSON was written there is
+// the result, however the CLI named it.
+func readWhisperOutput(dir string, output []byte) (*Transcript, error) {
+	outputs, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(outputs) != 1 {
+		return nil, fmt.Errorf("expected one JSON result from whisper, found %d\nOutput: %s", len(outputs), string(output))
+	}
+
+	file, err := os.Open(outputs[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript file: %v", err)
+	}
+	defer file.Close()
 
-	content, err := os.ReadFile(outputFilePath)
+	result, err := ParseWhisperJSON(file)
 	if err != nil {
-		return "", fmt.Errorf("failed to read transcript file: %v", err)
+		return nil, fmt.Errorf("failed to parse transcript file: %v", err)
 	}
 
-	return string(content), nil
+	return result.Transcript(), nil
 }
@@ -1,12 +1,16 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHelperProcessWhisper(t *testing.T) {
@@ -30,7 +34,7 @@ func TestHelperProcessWhisper(t *testing.T) {
 	// Check if it's whisper (or the fallback path)
 	if strings.Contains(cmd, "whisper") {
 		// Parse args to find output dir and audio path
-		// args: [whisper, audioPath, --model, base, --output_format, txt, --output_dir, tempDir]
+		// args: [whisper, audioPath, --model, base, --output_format, json, --word_timestamps, True, --output_dir, tempDir, ...]
 		var outputDir string
 		var audioPath string
 		for i, arg := range args {
@@ -46,9 +50,18 @@ func TestHelperProcessWhisper(t *testing.T) {
 			// Create the output file
 			baseName := filepath.Base(audioPath)
 			fileNameWithoutExt := strings.TrimSuffix(baseName, filepath.Ext(baseName))
-			outputFile := filepath.Join(outputDir, fileNameWithoutExt+".txt")
+			outputFile := filepath.Join(outputDir, fileNameWithoutExt+".json")
 
-			err := os.WriteFile(outputFile, []byte("Transcribed text"), 0644)
+			result := `{"text": " Transcribed text", "segments": [
+				{"start": 0.0, "end": 1.5, "text": " Transcribed", "words": [
+					{"word": " Transcribed", "start": 0.1, "end": 1.2, "probability": 0.93}]},
+				{"start": 1.5, "end": 3.0, "text": " text", "words": [
+					{"word": " text", "start": 1.6, "end": 2.4, "probability": 0.88}]}
+			], "language": "en"}`
+			err := os.WriteFile(outputFile, []byte(result), 0644)
+			// Verbose mode echoes each segment as it is decoded
+			fmt.Println("[00:00.000 --> 00:01.500]  Transcribed")
+			fmt.Println("[00:01.500 --> 00:03.000]  text")
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to write output file: %v\n", err)
 				os.Exit(1)
@@ -60,7 +73,23 @@ func TestHelperProcessWhisper(t *testing.T) {
 	os.Exit(2)
 }
 
+// mockWhisperCLI runs TestHelperProcessWhisper in place of a whisper-style
+// CLI and records the command line.
+func mockWhisperCLI(t *testing.T, args *[]string) {
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		*args = append([]string{name}, arg...)
+		cs := []string{"-test.run=TestHelperProcessWhisper", "--", name}
+		cs = append(cs, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+	t.Cleanup(func() { execCommand = exec.Command })
+}
+
 func TestTranscribeAudioLocal(t *testing.T) {
+	// An active virtualenv would be searched before PATH
+	t.Setenv("VIRTUAL_ENV", "")
 	// Mock execLookPath
 	execLookPath = func(file string) (string, error) {
 		return "/usr/bin/whisper", nil
@@ -85,11 +114,129 @@ func TestTranscribeAudioLocal(t *testing.T) {
 	defer os.Remove(tmpFile.Name())
 
 	// Test
-	text, err := TranscribeAudioLocal(tmpFile.Name())
+	transcript, err := TranscribeAudioLocal(tmpFile.Name())
 	if err != nil {
-		t.Errorf("TranscribeAudioLocal failed: %v", err)
+		t.Fatalf("TranscribeAudioLocal failed: %v", err)
 	}
-	if text != "Transcribed text" {
+	if text := transcript.Text(); text != "Transcribed text" {
 		t.Errorf("Expected 'Transcribed text', got '%s'", text)
 	}
+	if len(transcript.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(transcript.Segments))
+	}
+	if transcript.Segments[1].Start != 1500*time.Millisecond || transcript.Segments[1].End != 3*time.Second {
+		t.Errorf("Unexpected timing for second segment: %+v", transcript.Segments[1])
+	}
+	words := transcript.Segments[1].Words
+	if len(words) != 1 || words[0].Start != 1600*time.Millisecond || words[0].End != 2400*time.Millisecond || words[0].Probability != 0.88 || words[0].Text != "text" {
+		t.Errorf("Unexpected words for second segment: %+v", words)
+	}
+
+	// Progress is parsed from the verbose output
+	var positions []time.Duration
+	_, err = LocalWhisper{}.Transcribe(context.Background(), tmpFile.Name(), TranscribeOptions{
+		Progress: func(position time.Duration) { positions = append(positions, position) },
+	})
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	if len(positions) != 2 || positions[1] != 3*time.Second {
+		t.Errorf("Expected progress [1.5s 3s], got %v", positions)
+	}
+}
+
+func TestLocalWhisperModel(t *testing.T) {
+	var args []string
+	mockWhisperCLI(t, &args)
+	audio := filepath.Join(t.TempDir(), "audio.wav")
+	if err := os.WriteFile(audio, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		defaultModel string
+		model        string
+		want         string
+	}{
+		{"Built-in default", "", "", "--model base"},
+		{"Configured default", "small.en", "", "--model small.en"},
+		{"Job's choice", "small.en", "large", "--model large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := LocalWhisper{Command: []string{"/opt/venv/bin/whisper"}, DefaultModel: tt.defaultModel}
+			if _, err := l.Transcribe(context.Background(), audio, TranscribeOptions{Model: tt.model}); err != nil {
+				t.Fatalf("Transcribe failed: %v", err)
+			}
+			command := strings.Join(args, " ")
+			if !strings.HasPrefix(command, "/opt/venv/bin/whisper "+audio) || !strings.Contains(command, tt.want) {
+				t.Errorf("Expected %q with %q, got %q", "/opt/venv/bin/whisper", tt.want, command)
+			}
+		})
+	}
+}
+
+func TestLocalWhisperUserText(t *testing.T) {
+	var args []string
+	mockWhisperCLI(t, &args)
+	audio := filepath.Join(t.TempDir(), "audio.wav")
+	if err := os.WriteFile(audio, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A prompt starting with a dash must not be parsed as an option
+	opts := TranscribeOptions{Language: "de", Prompt: "-Alice, Bob"}
+	if _, err := (LocalWhisper{Command: []string{"whisper"}}).Transcribe(context.Background(), audio, opts); err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	for _, want := range []string{"--language=de", "--initial_prompt=-Alice, Bob"} {
+		if !slices.Contains(args, want) {
+			t.Errorf("Expected argument %q, got %q", want, args)
+		}
+	}
+}
+
+func TestFindWhisper(t *testing.T) {
+	venv := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(venv, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(venv, "bin", "whisper"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VIRTUAL_ENV", "")
+
+	tests := []struct {
+		name    string
+		inPath  []string
+		search  WhisperSearch
+		want    []string
+		wantErr string
+	}{
+		{"Explicit path", []string{"whisper"}, WhisperSearch{Path: "/srv/whisper", Venv: venv}, []string{"/srv/whisper"}, ""},
+		{"Missing explicit path", []string{"whisper"}, WhisperSearch{Path: "whisper-old"}, nil, "whisper CLI whisper-old not found"},
+		{"Virtualenv before PATH", []string{"whisper"}, WhisperSearch{Venv: venv}, []string{filepath.Join(venv, "bin", "whisper")}, ""},
+		{"PATH", []string{"whisper"}, WhisperSearch{Venv: t.TempDir()}, []string{"/usr/bin/whisper"}, ""},
+		{"Python module", nil, WhisperSearch{}, []string{"python3", "-m", "whisper"}, ""},
+		{"Nowhere", nil, WhisperSearch{Python: "/usr/bin/nopython"}, nil, "tried whisper in PATH, /usr/bin/nopython -m whisper"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTools(t, tt.inPath...)
+			got, err := FindWhisper(tt.search)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindWhisper failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
 }
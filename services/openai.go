@@ -1,7 +1,7 @@
 package services
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,73 +9,300 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+// TranscriptionResponse is the API's JSON response. A json response only has
+// Text; verbose_json adds the rest.
 type TranscriptionResponse struct {
+	Task string `json:"task"`
 	Text string `json:"text"`
+	// Language is the detected or requested language's English name, e.g.
+	// "english".
+	Language string `json:"language"`
+	// Duration is the length of the audio in seconds.
+	Duration float64           `json:"duration"`
+	Segments []ResponseSegment `json:"segments"`
+	// Words are only sent when word timestamps are requested, for the whole
+	// file rather than per segment.
+	Words []ResponseWord `json:"words"`
 }
 
-var OpenAIEndpoint = "https://api.openai.com/v1/audio/transcriptions"
+// ResponseSegment is a timed segment in a verbose_json transcription response.
+// Times are in seconds.
+type ResponseSegment struct {
+	ID     int     `json:"id"`
+	Seek   int     `json:"seek"`
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+	Text   string  `json:"text"`
+	Tokens []int   `json:"tokens"`
+	// The decoder's confidence data, as in WhisperSegment. Compatible
+	// servers may leave it out.
+	AvgLogProb       *float64 `json:"avg_logprob"`
+	NoSpeechProb     float64  `json:"no_speech_prob"`
+	CompressionRatio float64  `json:"compression_ratio"`
+	Temperature      float64  `json:"temperature"`
+}
 
-// TranscribeAudio sends the audio file to OpenAI Whisper API.
-func TranscribeAudio(audioPath string, apiKey string) (string, error) {
-	url := OpenAIEndpoint
+// ResponseWord is a timed word in a verbose_json transcription response.
+type ResponseWord struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
 
-	// Open the file
-	file, err := os.Open(audioPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
+var (
+	// OpenAIMaxUpload is the API's limit on the size of one audio file.
+	// Longer audio is split into chunks that fit.
+	OpenAIMaxUpload int64 = 25 << 20
+	// OpenAIParallelism is how many chunks of one file are sent at once.
+	OpenAIParallelism = 4
+)
 
-	// Create multipart writer
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// OpenAIModels are the transcription models jobs can pick. The API's GPT-4o
+// models are left out: they answer with plain text, which has no timestamps
+// to make subtitles from.
+var OpenAIModels = []string{"whisper-1"}
 
-	// Add file field
-	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
-	if err != nil {
-		return "", err
+// OpenAIOptions are the parameters of one transcription request.
+type OpenAIOptions struct {
+	// Model defaults to whisper-1.
+	Model string
+	// Language is an ISO 639-1 code; empty lets the model detect it.
+	Language string
+	// Prompt guides the style and spelling of the transcript, e.g. names
+	// and jargon that appear in the audio.
+	Prompt string
+	// Temperature is the sampling temperature from 0 to 1; 0 lets the API
+	// pick.
+	Temperature float64
+	// ResponseFormat is verbose_json, json, text or srt. The default is
+	// verbose_json, which has timestamps, except for OpenAI's GPT-4o models
+	// that don't support it and get json.
+	ResponseFormat string
+}
+
+func (o OpenAIOptions) withDefaults() OpenAIOptions {
+	if o.Model == "" {
+		o.Model = OpenAIModels[0]
 	}
-	_, err = io.Copy(part, file)
-	if err != nil {
-		return "", err
+	if o.ResponseFormat == "" {
+		o.ResponseFormat = "verbose_json"
+		if strings.HasPrefix(o.Model, "gpt-4o") {
+			o.ResponseFormat = "json"
+		}
 	}
+	return o
+}
 
-	// Add model field
-	_ = writer.WriteField("model", "whisper-1")
+// OpenAI is the Transcriber backed by an OpenAI-compatible transcription
+// API.
+type OpenAI struct {
+	// Profile is the server to use. The zero value is OpenAIProfile
+	// without a key.
+	Profile APIProfile
+	// Client sends the requests. Nil means a client with DefaultAPITimeout
+	// and the default retries.
+	Client *APIClient
+}
 
-	err = writer.Close()
-	if err != nil {
-		return "", err
+func (o OpenAI) profile() APIProfile {
+	if o.Profile.BaseURL == "" {
+		return OpenAIProfile
 	}
+	return o.Profile
+}
 
-	// Create request
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return "", err
+func (o OpenAI) Name() string        { return o.profile().Name }
+func (o OpenAI) Description() string { return o.profile().Description }
+
+func (o OpenAI) Capabilities() Capabilities {
+	// OpenAI takes at most 25 MB per request; Opus fits hours of speech
+	return Capabilities{Timestamps: true, WordTimings: true, Audio: ProfileOpus, Models: o.profile().Models}
+}
+
+func (o OpenAI) Transcribe(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	profile := o.profile()
+	apiOpts := OpenAIOptions{
+		Model:       profile.defaultModel(),
+		Language:    opts.Language,
+		Prompt:      opts.Prompt,
+		Temperature: opts.Temperature,
+	}
+	if opts.Model != "" {
+		apiOpts.Model = opts.Model
+	}
+	chunkOpts := ChunkOptions{
+		MaxBytes:    profile.maxUpload(),
+		Parallelism: OpenAIParallelism,
+		Progress:    opts.Progress,
+	}
+	client := o.Client
+	if client == nil {
+		client = defaultAPIClient
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	return TranscribeChunked(ctx, audioPath, chunkOpts, func(ctx context.Context, path string) (*Transcript, error) {
+		return transcribeAudio(ctx, client, profile, path, apiOpts)
+	})
+}
 
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+// TranscribeAudio sends the audio file to OpenAI Whisper API in a single
+// request. OpenAI.Transcribe also handles files over the size limit.
+func TranscribeAudio(audioPath string, apiKey string) (*Transcript, error) {
+	profile := OpenAIProfile
+	profile.APIKey = apiKey
+	return TranscribeAudioWithOptions(context.Background(), audioPath, profile, OpenAIOptions{})
+}
+
+// TranscribeAudioWithOptions sends the audio file to the profile's server
+// in a single request, with the request parameters in opts.
+func TranscribeAudioWithOptions(ctx context.Context, audioPath string, profile APIProfile, opts OpenAIOptions) (*Transcript, error) {
+	return transcribeAudio(ctx, defaultAPIClient, profile, audioPath, opts)
+}
+
+func transcribeAudio(ctx context.Context, client *APIClient, profile APIProfile, audioPath string, opts OpenAIOptions) (*Transcript, error) {
+	opts = opts.withDefaults()
+	switch opts.ResponseFormat {
+	case "verbose_json", "json", "text", "srt":
+	default:
+		return nil, fmt.Errorf("unsupported response format %q", opts.ResponseFormat)
 	}
-	defer resp.Body.Close()
+	url := profile.endpoint()
+
+	// Send request, retrying with a fresh body each time
+	resp, err := client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		file, err := os.Open(audioPath)
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+		// Stream the multipart body instead of building it in memory
+		pr, pw := io.Pipe()
+		writer := multipart.NewWriter(pw)
+		go func() {
+			defer file.Close()
+			pw.CloseWithError(writeTranscriptionForm(writer, file, filepath.Base(audioPath), opts))
+		}()
+
+		req, err := http.NewRequestWithContext(ctx, "POST", url, pr)
+		if err != nil {
+			// Unblock the writer
+			pr.CloseWithError(err)
+			return nil, err
+		}
+		for name, value := range profile.Headers {
+			req.Header.Set(name, value)
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if profile.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+profile.APIKey)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
 	// Parse response
+	switch opts.ResponseFormat {
+	case "text":
+		text, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &Transcript{Segments: []Segment{{Text: strings.TrimSpace(string(text))}}}, nil
+	case "srt":
+		segments, err := ParseSRT(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &Transcript{Segments: segments}, nil
+	}
 	var result TranscriptionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return nil, err
+	}
+
+	return result.transcript(), nil
+}
+
+func writeTranscriptionForm(writer *multipart.Writer, audio io.Reader, filename string, opts OpenAIOptions) error {
+	// Add file field
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, audio); err != nil {
+		return err
 	}
 
-	return result.Text, nil
+	_ = writer.WriteField("model", opts.Model)
+	// verbose_json is the only JSON format that includes segment timings
+	_ = writer.WriteField("response_format", opts.ResponseFormat)
+	if opts.ResponseFormat == "verbose_json" {
+		// Asking for words alone would drop the segments
+		_ = writer.WriteField("timestamp_granularities[]", "segment")
+		_ = writer.WriteField("timestamp_granularities[]", "word")
+	}
+	if opts.Language != "" {
+		_ = writer.WriteField("language", opts.Language)
+	}
+	if opts.Prompt != "" {
+		_ = writer.WriteField("prompt", opts.Prompt)
+	}
+	if opts.Temperature > 0 {
+		_ = writer.WriteField("temperature", strconv.FormatFloat(opts.Temperature, 'f', -1, 64))
+	}
+
+	return writer.Close()
+}
+
+func (r *TranscriptionResponse) transcript() *Transcript {
+	t := &Transcript{Language: r.Language}
+	for _, seg := range r.Segments {
+		s := Segment{
+			Start: secondsToDuration(seg.Start),
+			End:   secondsToDuration(seg.End),
+			Text:  seg.Text,
+		}
+		if seg.AvgLogProb != nil {
+			s.Confidence = &Confidence{
+				AvgLogProb:       *seg.AvgLogProb,
+				NoSpeechProb:     seg.NoSpeechProb,
+				CompressionRatio: seg.CompressionRatio,
+				Temperature:      seg.Temperature,
+			}
+		}
+		t.Segments = append(t.Segments, s)
+	}
+	// Some compatible servers ignore response_format and only send text
+	if len(t.Segments) == 0 && r.Text != "" {
+		t.Segments = []Segment{{Text: r.Text}}
+	}
+	attachWords(t.Segments, r.Words)
+	return t
+}
+
+// attachWords gives each word to the segment its midpoint falls in, or to
+// the last segment starting before it. Both lists are in time order.
+func attachWords(segments []Segment, words []ResponseWord) {
+	if len(segments) == 0 {
+		return
+	}
+	i := 0
+	for _, w := range words {
+		word := Word{
+			Start: secondsToDuration(w.Start),
+			End:   secondsToDuration(w.End),
+			Text:  strings.TrimSpace(w.Word),
+		}
+		mid := (word.Start + word.End) / 2
+		for i+1 < len(segments) && segments[i+1].Start <= mid {
+			i++
+		}
+		segments[i].Words = append(segments[i].Words, word)
+	}
 }
@@ -1,13 +1,22 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
+// testProfile points at an httptest stand-in for the API.
+func testProfile(url string) APIProfile {
+	return APIProfile{Name: "test", Description: "Test API", BaseURL: url, APIKey: "test-api-key"}
+}
+
 func TestTranscribeAudio(t *testing.T) {
 	// Mock server
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -15,22 +24,29 @@ func TestTranscribeAudio(t *testing.T) {
 		if r.Method != "POST" {
 			t.Errorf("Expected POST request, got %s", r.Method)
 		}
+		if r.URL.Path != "/audio/transcriptions" {
+			t.Errorf("Expected the transcriptions endpoint, got %s", r.URL.Path)
+		}
 		// Verify auth header
 		if r.Header.Get("Authorization") != "Bearer test-api-key" {
 			t.Errorf("Expected Authorization header, got %s", r.Header.Get("Authorization"))
 		}
 
+		// Verify timed output was requested
+		if r.FormValue("response_format") != "verbose_json" {
+			t.Errorf("Expected verbose_json response_format, got %q", r.FormValue("response_format"))
+		}
+		if got := r.MultipartForm.Value["timestamp_granularities[]"]; len(got) != 2 || got[0] != "segment" || got[1] != "word" {
+			t.Errorf("Expected segment and word granularities, got %q", got)
+		}
+
 		// Return success response
 		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintln(w, `{"text": "Hello world"}`)
+		fmt.Fprintln(w, `{"text": "Hello world", "segments": [{"start": 0.0, "end": 1.2, "text": "Hello"}, {"start": 1.2, "end": 2.5, "text": " world"}],
+			"words": [{"word": "Hello", "start": 0.1, "end": 0.9}, {"word": "world", "start": 1.1, "end": 2.0}]}`)
 	}))
 	defer ts.Close()
 
-	// Override endpoint
-	originalEndpoint := OpenAIEndpoint
-	OpenAIEndpoint = ts.URL
-	defer func() { OpenAIEndpoint = originalEndpoint }()
-
 	// Create dummy audio file
 	tmpFile, err := os.CreateTemp("", "audio.mp3")
 	if err != nil {
@@ -41,14 +57,30 @@ func TestTranscribeAudio(t *testing.T) {
 	tmpFile.Close()
 
 	// Call function
-	text, err := TranscribeAudio(tmpFile.Name(), "test-api-key")
+	transcript, err := TranscribeAudioWithOptions(context.Background(), tmpFile.Name(), testProfile(ts.URL), OpenAIOptions{})
 	if err != nil {
-		t.Fatalf("TranscribeAudio failed: %v", err)
+		t.Fatalf("TranscribeAudioWithOptions failed: %v", err)
 	}
 
-	if text != "Hello world" {
+	if text := transcript.Text(); text != "Hello world" {
 		t.Errorf("Expected 'Hello world', got '%s'", text)
 	}
+	if len(transcript.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(transcript.Segments))
+	}
+	if transcript.Segments[0].End != 1200*time.Millisecond {
+		t.Errorf("Expected first segment to end at 1.2s, got %v", transcript.Segments[0].End)
+	}
+	// Words are sent for the whole file and sorted into their segments
+	for i, want := range []string{"Hello", "world"} {
+		words := transcript.Segments[i].Words
+		if len(words) != 1 || words[0].Text != want {
+			t.Errorf("Segment %d: expected the word %q, got %+v", i, want, words)
+		}
+	}
+	if w := transcript.Segments[1].Words[0]; w.Start != 1100*time.Millisecond || w.End != 2*time.Second {
+		t.Errorf("Unexpected timing for %q: %v-%v", w.Text, w.Start, w.End)
+	}
 }
 
 func TestTranscribeAudioError(t *testing.T) {
@@ -59,13 +91,160 @@ func TestTranscribeAudioError(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	OpenAIEndpoint = ts.URL
-
 	tmpFile, _ := os.CreateTemp("", "audio.mp3")
 	defer os.Remove(tmpFile.Name())
 
-	_, err := TranscribeAudio(tmpFile.Name(), "key")
+	_, err := TranscribeAudioWithOptions(context.Background(), tmpFile.Name(), testProfile(ts.URL), OpenAIOptions{})
 	if err == nil {
 		t.Error("Expected error, got nil")
 	}
 }
+
+func TestTranscribeAudioWithOptions(t *testing.T) {
+	var form map[string][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("Expected a multipart form: %v", err)
+		}
+		form = r.MultipartForm.Value
+		switch r.FormValue("response_format") {
+		case "text":
+			fmt.Fprintln(w, "Plain text.")
+		case "srt":
+			fmt.Fprint(w, "1\n00:00:01,000 --> 00:00:02,000\nTimed text\n\n")
+		default:
+			fmt.Fprintln(w, `{"text": "Hello from GPT-4o"}`)
+		}
+	}))
+	defer ts.Close()
+	profile := testProfile(ts.URL)
+
+	audioPath := filepath.Join(t.TempDir(), "audio.ogg")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Models without verbose_json get json, and no timestamp granularities
+	transcript, err := TranscribeAudioWithOptions(context.Background(), audioPath, profile, OpenAIOptions{
+		Model:       "gpt-4o-transcribe",
+		Language:    "de",
+		Prompt:      "Müller, Bundestag",
+		Temperature: 0.2,
+	})
+	if err != nil {
+		t.Fatalf("TranscribeAudioWithOptions failed: %v", err)
+	}
+	want := map[string]string{
+		"model":           "gpt-4o-transcribe",
+		"response_format": "json",
+		"language":        "de",
+		"prompt":          "Müller, Bundestag",
+		"temperature":     "0.2",
+	}
+	for field, value := range want {
+		if got := form[field]; len(got) != 1 || got[0] != value {
+			t.Errorf("Expected %s=%q, got %q", field, value, got)
+		}
+	}
+	if _, ok := form["timestamp_granularities[]"]; ok {
+		t.Error("Expected no timestamp granularities without verbose_json")
+	}
+	if transcript.Text() != "Hello from GPT-4o" {
+		t.Errorf("Unexpected transcript %q", transcript.Text())
+	}
+
+	// Plain formats are parsed too
+	transcript, err = TranscribeAudioWithOptions(context.Background(), audioPath, profile, OpenAIOptions{ResponseFormat: "text"})
+	if err != nil || transcript.Text() != "Plain text." {
+		t.Errorf("Expected the text response, got %v, %v", transcript, err)
+	}
+	transcript, err = TranscribeAudioWithOptions(context.Background(), audioPath, profile, OpenAIOptions{ResponseFormat: "srt"})
+	if err != nil || len(transcript.Segments) != 1 || transcript.Segments[0].Start != time.Second {
+		t.Errorf("Expected the SRT response, got %v, %v", transcript, err)
+	}
+	if _, err := TranscribeAudioWithOptions(context.Background(), audioPath, profile, OpenAIOptions{ResponseFormat: "vtt"}); err == nil {
+		t.Error("Expected an error for an unsupported response format")
+	}
+}
+
+func TestOpenAIProfile(t *testing.T) {
+	var header http.Header
+	var model, format string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		model, format = r.FormValue("model"), r.FormValue("response_format")
+		fmt.Fprintln(w, `{"text": "Hi", "segments": [{"start": 0.5, "end": 1.0, "text": "Hi"}]}`)
+	}))
+	defer ts.Close()
+
+	// A self-hosted server with its own models, behind a proxy, without auth
+	backend := OpenAI{Profile: APIProfile{
+		Name:        "team",
+		Description: "Team Whisper server",
+		BaseURL:     ts.URL + "/v1/",
+		Models:      []string{"Systran/faster-whisper-small", "Systran/faster-whisper-large-v3"},
+		Headers:     map[string]string{"X-Team": "subtitles"},
+	}}
+	if backend.Name() != "team" || backend.Description() != "Team Whisper server" {
+		t.Errorf("Expected the profile's name, got %q, %q", backend.Name(), backend.Description())
+	}
+	if !backend.Capabilities().SupportsModel("Systran/faster-whisper-large-v3") || backend.Capabilities().SupportsModel("whisper-1") {
+		t.Error("Expected the profile's models")
+	}
+
+	audioPath := filepath.Join(t.TempDir(), "audio.ogg")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Transcribe(context.Background(), audioPath, TranscribeOptions{}); err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	if header.Get("X-Team") != "subtitles" || header.Get("Authorization") != "" {
+		t.Errorf("Expected the profile's headers and no auth, got %v", header)
+	}
+	if model != "Systran/faster-whisper-small" || format != "verbose_json" {
+		t.Errorf("Expected the profile's first model with verbose_json, got %q, %q", model, format)
+	}
+
+	// The zero value is OpenAI itself
+	if (OpenAI{}).Name() != "openai" {
+		t.Errorf("Expected the zero value to be openai, got %q", OpenAI{}.Name())
+	}
+}
+
+func TestOpenAITranscribeChunks(t *testing.T) {
+	mockFFmpeg(t)
+
+	var mu sync.Mutex
+	var files []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected a file upload: %v", err)
+			return
+		}
+		mu.Lock()
+		files = append(files, header.Filename)
+		mu.Unlock()
+		fmt.Fprintln(w, `{"text": "Hi", "segments": [{"start": 0.5, "end": 1.0, "text": "Hi"}]}`)
+	}))
+	defer ts.Close()
+
+	originalMax := OpenAIMaxUpload
+	OpenAIMaxUpload = 300
+	defer func() { OpenAIMaxUpload = originalMax }()
+
+	// 10 s of audio that is over the limit, so it is split into 4 chunks
+	audioPath := writeTestAudio(t, 1000)
+	transcript, err := OpenAI{Profile: testProfile(ts.URL)}.Transcribe(context.Background(), audioPath, TranscribeOptions{})
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+
+	if len(files) != 4 {
+		t.Errorf("Expected 4 chunk uploads, got %v", files)
+	}
+	if len(transcript.Segments) != 4 || transcript.Segments[3].Start != 7900*time.Millisecond {
+		t.Errorf("Expected 4 segments with the last one shifted to 7.9s, got %+v", transcript.Segments)
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MediaInfo is what ffprobe found in an uploaded file.
+type MediaInfo struct {
+	// Container is ffprobe's format name, e.g. "mov,mp4,m4a,3gp,3g2,mj2".
+	Container string        `json:"container"`
+	Duration  time.Duration `json:"duration"`
+	// Video is the first video stream, or nil for audio-only files.
+	Video *VideoStream  `json:"video,omitempty"`
+	Audio []AudioStream `json:"audio,omitempty"`
+}
+
+type VideoStream struct {
+	Codec  string `json:"codec"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type AudioStream struct {
+	// Index is the stream's index in the file, counting all stream types.
+	Index      int    `json:"index"`
+	Codec      string `json:"codec"`
+	Channels   int    `json:"channels"`
+	SampleRate int    `json:"sampleRate"`
+	// Language is the stream's ISO 639-2 tag, e.g. "eng", if it has one.
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// ErrNoAudio is returned by ProbeMedia for files without an audio stream,
+// which have nothing to transcribe.
+var ErrNoAudio = errors.New("the file has no audio track")
+
+// HasAudio reports whether there is anything to transcribe.
+func (m *MediaInfo) HasAudio() bool {
+	return len(m.Audio) > 0
+}
+
+// AudioLabels describes each audio stream for a track picker, e.g.
+// "Track 2 · fra · Commentary · ac3 6ch", in the order of Audio.
+func (m *MediaInfo) AudioLabels() []string {
+	labels := make([]string, len(m.Audio))
+	for i, a := range m.Audio {
+		parts := []string{fmt.Sprintf("Track %d", i+1)}
+		if a.Language != "" && a.Language != "und" {
+			parts = append(parts, a.Language)
+		}
+		if a.Title != "" {
+			parts = append(parts, a.Title)
+		}
+		parts = append(parts, fmt.Sprintf("%s %dch", a.Codec, a.Channels))
+		labels[i] = strings.Join(parts, " · ")
+	}
+	return labels
+}
+
+// Resolution is the video size as "1920×1080", or "" without video.
+func (m *MediaInfo) Resolution() string {
+	if m.Video == nil || m.Video.Width == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d×%d", m.Video.Width, m.Video.Height)
+}
+
+// Summary describes the file in one line for the UI, e.g.
+// "00:01:30 · 1920×1080 · h264 · 2 audio tracks".
+func (m *MediaInfo) Summary() string {
+	parts := []string{FormatTimestamp(m.Duration, ".")[:8]}
+	if res := m.Resolution(); res != "" {
+		parts = append(parts, res)
+	}
+	if m.Video != nil {
+		parts = append(parts, m.Video.Codec)
+	}
+	switch len(m.Audio) {
+	case 0:
+		parts = append(parts, "no audio")
+	case 1:
+		parts = append(parts, m.Audio[0].Codec)
+	default:
+		parts = append(parts, fmt.Sprintf("%d audio tracks", len(m.Audio)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// MIMEType is the Content-Type a browser needs to play the file.
+func (m *MediaInfo) MIMEType() string {
+	kind := "video"
+	if m.Video == nil {
+		kind = "audio"
+	}
+	formats := strings.Split(m.Container, ",")
+	switch formats[0] {
+	case "mov":
+		// ffprobe can't tell MP4 and QuickTime apart by format name; both
+		// play as MP4 in browsers that support the codecs
+		return kind + "/mp4"
+	case "matroska":
+		// The same demuxer reads WebM, which browsers play natively
+		if m.webmCodecs() {
+			return kind + "/webm"
+		}
+		return kind + "/x-matroska"
+	case "ogg":
+		return kind + "/ogg"
+	case "avi":
+		return "video/x-msvideo"
+	case "mpegts":
+		return "video/mp2t"
+	case "mp3":
+		return "audio/mpeg"
+	case "wav":
+		return "audio/wav"
+	case "flac":
+		return "audio/flac"
+	}
+	return "application/octet-stream"
+}
+
+func (m *MediaInfo) webmCodecs() bool {
+	if m.Video != nil && m.Video.Codec != "vp8" && m.Video.Codec != "vp9" && m.Video.Codec != "av1" {
+		return false
+	}
+	for _, a := range m.Audio {
+		if a.Codec != "opus" && a.Codec != "vorbis" {
+			return false
+		}
+	}
+	return true
+}
+
+// ffprobeOutput is the part of `ffprobe -print_format json` we read.
+type ffprobeOutput struct {
+	Streams []struct {
+		Index       int               `json:"index"`
+		CodecType   string            `json:"codec_type"`
+		CodecName   string            `json:"codec_name"`
+		Width       int               `json:"width"`
+		Height      int               `json:"height"`
+		Channels    int               `json:"channels"`
+		SampleRate  string            `json:"sample_rate"`
+		Tags        map[string]string `json:"tags"`
+		Disposition map[string]int    `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+}
+
+// ProbeMedia inspects a media file with ffprobe. It returns ErrNoAudio,
+// along with the info, for files that can't be transcribed.
+func ProbeMedia(path string) (*MediaInfo, error) {
+	cmd := execCommand("ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v, output: %s", err, stderr.String())
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+	if probe.Format.FormatName == "" {
+		return nil, errors.New("ffprobe did not recognise the file")
+	}
+
+	info := &MediaInfo{Container: probe.Format.FormatName}
+	if seconds, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		info.Duration = secondsToDuration(seconds)
+	}
+	for _, s := range probe.Streams {
+		switch s.CodecType {
+		case "video":
+			// Cover art in audio files is reported as a video stream too
+			if info.Video == nil && s.Disposition["attached_pic"] == 0 {
+				info.Video = &VideoStream{Codec: s.CodecName, Width: s.Width, Height: s.Height}
+			}
+		case "audio":
+			rate, _ := strconv.Atoi(s.SampleRate)
+			info.Audio = append(info.Audio, AudioStream{
+				Index:      s.Index,
+				Codec:      s.CodecName,
+				Channels:   s.Channels,
+				SampleRate: rate,
+				Language:   s.Tags["language"],
+				Title:      s.Tags["title"],
+			})
+		}
+	}
+
+	if !info.HasAudio() {
+		return info, ErrNoAudio
+	}
+	return info, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+const ffprobeJSON = `{
+    "streams": [
+        {"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1920, "height": 1080, "disposition": {"attached_pic": 0}},
+        {"index": 1, "codec_name": "aac", "codec_type": "audio", "sample_rate": "48000", "channels": 2, "tags": {"language": "eng"}},
+        {"index": 2, "codec_name": "ac3", "codec_type": "audio", "sample_rate": "44100", "channels": 6, "tags": {"language": "fra", "title": "Commentary"}},
+        {"index": 3, "codec_name": "subrip", "codec_type": "subtitle"}
+    ],
+    "format": {"format_name": "matroska,webm", "duration": "90.500000", "size": "1234"}
+}`
+
+const ffprobeNoAudioJSON = `{
+    "streams": [{"index": 0, "codec_name": "vp9", "codec_type": "video", "width": 640, "height": 360}],
+    "format": {"format_name": "matroska,webm", "duration": "3.000000"}
+}`
+
+// TestHelperProcessFFprobe isn't a real test. It stands in for ffprobe and
+// prints the JSON named by FFPROBE_FIXTURE.
+func TestHelperProcessFFprobe(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	switch os.Getenv("FFPROBE_FIXTURE") {
+	case "video":
+		fmt.Print(ffprobeJSON)
+	case "silent":
+		fmt.Print(ffprobeNoAudioJSON)
+	default:
+		fmt.Fprintln(os.Stderr, "test.txt: Invalid data found when processing input")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func mockFFprobe(fixture string) func(string, ...string) *exec.Cmd {
+	return func(name string, arg ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcessFFprobe", "--", name}
+		cs = append(cs, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "FFPROBE_FIXTURE=" + fixture}
+		return cmd
+	}
+}
+
+func TestProbeMedia(t *testing.T) {
+	execCommand = mockFFprobe("video")
+	defer func() { execCommand = exec.Command }()
+
+	info, err := ProbeMedia("test.mkv")
+	if err != nil {
+		t.Fatalf("ProbeMedia failed: %v", err)
+	}
+	if info.Duration != 90500*time.Millisecond {
+		t.Errorf("Expected duration 1m30.5s, got %v", info.Duration)
+	}
+	if info.Resolution() != "1920×1080" || info.Video.Codec != "h264" {
+		t.Errorf("Unexpected video %+v", info.Video)
+	}
+	if len(info.Audio) != 2 {
+		t.Fatalf("Expected 2 audio streams, got %+v", info.Audio)
+	}
+	want := AudioStream{Index: 2, Codec: "ac3", Channels: 6, SampleRate: 44100, Language: "fra", Title: "Commentary"}
+	if info.Audio[1] != want {
+		t.Errorf("Expected %+v, got %+v", want, info.Audio[1])
+	}
+	labels := info.AudioLabels()
+	if len(labels) != 2 || labels[0] != "Track 1 · eng · aac 2ch" || labels[1] != "Track 2 · fra · Commentary · ac3 6ch" {
+		t.Errorf("Unexpected audio labels %q", labels)
+	}
+	// h264 in Matroska is not WebM
+	if got := info.MIMEType(); got != "video/x-matroska" {
+		t.Errorf("Expected video/x-matroska, got %s", got)
+	}
+	if got := info.Summary(); got != "00:01:30 · 1920×1080 · h264 · 2 audio tracks" {
+		t.Errorf("Unexpected summary %q", got)
+	}
+}
+
+func TestProbeMediaRejects(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+
+	execCommand = mockFFprobe("silent")
+	info, err := ProbeMedia("silent.webm")
+	if !errors.Is(err, ErrNoAudio) {
+		t.Errorf("Expected ErrNoAudio, got %v", err)
+	}
+	if info == nil || info.Resolution() != "640×360" {
+		t.Errorf("Expected the info along with ErrNoAudio, got %+v", info)
+	}
+
+	execCommand = mockFFprobe("garbage")
+	if _, err := ProbeMedia("test.txt"); err == nil || errors.Is(err, ErrNoAudio) {
+		t.Errorf("Expected an ffprobe error, got %v", err)
+	}
+}
+
+func TestMediaInfoMIMEType(t *testing.T) {
+	tests := []struct {
+		info MediaInfo
+		want string
+	}{
+		{MediaInfo{Container: "mov,mp4,m4a,3gp,3g2,mj2", Video: &VideoStream{Codec: "h264"}}, "video/mp4"},
+		{MediaInfo{Container: "mov,mp4,m4a,3gp,3g2,mj2"}, "audio/mp4"},
+		{MediaInfo{Container: "matroska,webm", Video: &VideoStream{Codec: "vp9"}, Audio: []AudioStream{{Codec: "opus"}}}, "video/webm"},
+		{MediaInfo{Container: "mp3"}, "audio/mpeg"},
+		{MediaInfo{Container: "avi", Video: &VideoStream{Codec: "mpeg4"}}, "video/x-msvideo"},
+		{MediaInfo{Container: "something_new"}, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.info.MIMEType(); got != tt.want {
+			t.Errorf("MIMEType() of %s = %s, want %s", tt.info.Container, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package services
+
+import "os/exec"
+
+// startInGroup does nothing where there are no process groups.
+func startInGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command itself; processes it started keep
+// running.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// APIProfile is an OpenAI-compatible transcription server: OpenAI itself,
+// or a self-hosted one such as faster-whisper-server or LocalAI. Each
+// profile is registered as its own backend.
+type APIProfile struct {
+	// Name is the backend's registry key.
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// BaseURL is the API root; requests go to BaseURL/audio/transcriptions.
+	BaseURL string `json:"baseURL"`
+	// APIKey is sent as a bearer token. Servers without auth leave it
+	// empty.
+	APIKey string `json:"apiKey,omitempty"`
+	// APIKeyEnv names an environment variable holding the key, to keep it
+	// out of the profiles file.
+	APIKeyEnv string `json:"apiKeyEnv,omitempty"`
+	// Models lists the models jobs can pick.
+	Models []string `json:"models,omitempty"`
+	// DefaultModel is used for jobs that don't pick one. Empty means the
+	// first of Models, or whisper-1.
+	DefaultModel string `json:"defaultModel,omitempty"`
+	// Headers are sent with every request, e.g. for a proxy in front of
+	// the server.
+	Headers map[string]string `json:"headers,omitempty"`
+	// MaxUploadMB is the server's limit on one audio file; longer audio is
+	// split to fit. Zero means OpenAI's 25 MB.
+	MaxUploadMB int64 `json:"maxUploadMB,omitempty"`
+	// TimeoutSeconds limits each request, chunk upload included. Self-hosted
+	// servers on a CPU can need far longer than OpenAI. Zero means the
+	// OpenAI client's timeout.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// OpenAIProfile is OpenAI's own API. main fills in the key.
+var OpenAIProfile = APIProfile{
+	Name:        "openai",
+	Description: "OpenAI Whisper API",
+	BaseURL:     "https://api.openai.com/v1",
+	Models:      OpenAIModels,
+}
+
+// endpoint is the URL of the transcriptions endpoint.
+func (p APIProfile) endpoint() string {
+	return strings.TrimSuffix(p.BaseURL, "/") + "/audio/transcriptions"
+}
+
+// maxUpload is the size chunks are cut to.
+func (p APIProfile) maxUpload() int64 {
+	if p.MaxUploadMB > 0 {
+		return p.MaxUploadMB << 20
+	}
+	return OpenAIMaxUpload
+}
+
+func (p APIProfile) defaultModel() string {
+	if p.DefaultModel != "" {
+		return p.DefaultModel
+	}
+	if len(p.Models) > 0 {
+		return p.Models[0]
+	}
+	return OpenAIModels[0]
+}
+
+// reservedBackendNames are the built-in backends and AutoBackend, which no
+// profile may be named after, whether or not they are registered.
+var reservedBackendNames = []string{
+	LocalWhisper{}.Name(), OpenAIProfile.Name, WhisperCpp{}.Name(), FasterWhisper{}.Name(), (&Fake{}).Name(), AutoBackend,
+}
+
+// LoadAPIProfiles reads a JSON array of profiles, resolving APIKeyEnv.
+func LoadAPIProfiles(path string) ([]APIProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []APIProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("invalid profiles file %s: %v", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range profiles {
+		p := &profiles[i]
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile %d has no name", i+1)
+		}
+		if slices.Contains(reservedBackendNames, p.Name) {
+			return nil, fmt.Errorf("profile %q: the name is reserved for a built-in backend", p.Name)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("profile %q is defined twice", p.Name)
+		}
+		seen[p.Name] = true
+		if u, err := url.Parse(p.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("profile %q: baseURL must be an http or https URL", p.Name)
+		}
+		if p.TimeoutSeconds < 0 {
+			return nil, fmt.Errorf("profile %q: timeoutSeconds must not be negative", p.Name)
+		}
+		if p.Description == "" {
+			p.Description = p.Name
+		}
+		if p.APIKeyEnv != "" {
+			p.APIKey = os.Getenv(p.APIKeyEnv)
+			if p.APIKey == "" {
+				return nil, fmt.Errorf("profile %q: %s is not set", p.Name, p.APIKeyEnv)
+			}
+		}
+	}
+	return profiles, nil
+}
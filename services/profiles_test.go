@@ -0,0 +1,75 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProfiles(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAPIProfiles(t *testing.T) {
+	t.Setenv("TEAM_WHISPER_KEY", "secret")
+	path := writeProfiles(t, `[
+		{"name": "team", "description": "Team Whisper server", "baseURL": "http://whisper.internal:8000/v1",
+		 "apiKeyEnv": "TEAM_WHISPER_KEY", "models": ["Systran/faster-whisper-large-v3"],
+		 "headers": {"X-Team": "subtitles"}, "maxUploadMB": 200},
+		{"name": "localai", "baseURL": "https://localai.example.com/v1"}
+	]`)
+
+	profiles, err := LoadAPIProfiles(path)
+	if err != nil {
+		t.Fatalf("LoadAPIProfiles failed: %v", err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("Expected 2 profiles, got %d", len(profiles))
+	}
+	team := profiles[0]
+	if team.APIKey != "secret" || team.Headers["X-Team"] != "subtitles" || team.maxUpload() != 200<<20 {
+		t.Errorf("Unexpected team profile: %+v", team)
+	}
+	if team.endpoint() != "http://whisper.internal:8000/v1/audio/transcriptions" {
+		t.Errorf("Unexpected endpoint %q", team.endpoint())
+	}
+	if team.defaultModel() != "Systran/faster-whisper-large-v3" {
+		t.Errorf("Expected the first model as default, got %q", team.defaultModel())
+	}
+	// Defaults
+	localai := profiles[1]
+	if localai.Description != "localai" || localai.defaultModel() != "whisper-1" || localai.maxUpload() != OpenAIMaxUpload {
+		t.Errorf("Unexpected defaults: %+v", localai)
+	}
+}
+
+func TestLoadAPIProfilesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"Not JSON", `name: team`, "invalid profiles file"},
+		{"No name", `[{"baseURL": "http://localhost:8000/v1"}]`, "has no name"},
+		{"Duplicate", `[{"name": "a", "baseURL": "http://x/v1"}, {"name": "a", "baseURL": "http://y/v1"}]`, "defined twice"},
+		{"Built-in name", `[{"name": "whispercpp", "baseURL": "http://x/v1"}]`, "reserved"},
+		{"Automatic", `[{"name": "auto", "baseURL": "http://x/v1"}]`, "reserved"},
+		{"Negative timeout", `[{"name": "a", "baseURL": "http://x/v1", "timeoutSeconds": -1}]`, "timeoutSeconds"},
+		{"Bad URL", `[{"name": "a", "baseURL": "localhost:8000"}]`, "baseURL must be"},
+		{"Missing key", `[{"name": "a", "baseURL": "http://x/v1", "apiKeyEnv": "NO_SUCH_KEY_SET"}]`, "NO_SUCH_KEY_SET is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadAPIProfiles(writeProfiles(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressFunc receives how far into the media a long-running step is.
+// total is zero when the length of the media is not known.
+type ProgressFunc func(position, total time.Duration)
+
+// Progress is a snapshot of how far the current stage of a job has got.
+type Progress struct {
+	Position time.Duration `json:"position"`
+	Duration time.Duration `json:"duration"`
+	// ETA is the estimated time left in the current stage, or zero.
+	ETA time.Duration `json:"eta"`
+}
+
+// Known reports whether a percentage can be shown.
+func (p Progress) Known() bool {
+	return p.Duration > 0
+}
+
+// Percent is the completed fraction of the current stage, from 0 to 100.
+func (p Progress) Percent() int {
+	if p.Duration <= 0 {
+		return 0
+	}
+	pct := int(100 * p.Position / p.Duration)
+	if pct > 100 {
+		pct = 100
+	}
+	return pct
+}
+
+// runCommand runs cmd and calls onLine with each line it prints to stdout or
+// stderr as soon as the line is written. Carriage returns also end a line,
+// since progress bars redraw with them. Like CombinedOutput, it returns
+// everything the command printed. Cancelling ctx kills the command and the
+// processes it started.
+func runCommand(ctx context.Context, cmd *exec.Cmd, onLine func(string)) ([]byte, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Wrapper scripts pass the pipes on to what they run, so only killing
+	// the whole group closes them and ends the scans below
+	startInGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-exited:
+		}
+	}()
+
+	var mu sync.Mutex
+	var output bytes.Buffer
+	var wg sync.WaitGroup
+	scan := func(r io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		scanner.Split(scanLinesOrReturns)
+		for scanner.Scan() {
+			line := scanner.Text()
+			mu.Lock()
+			output.WriteString(line)
+			output.WriteByte('\n')
+			if onLine != nil {
+				onLine(line)
+			}
+			mu.Unlock()
+		}
+		// Keep draining so the command never blocks on a full pipe
+		io.Copy(io.Discard, r)
+	}
+	wg.Add(2)
+	go scan(stdout)
+	go scan(stderr)
+	// The pipes must be fully read before Wait closes them
+	wg.Wait()
+
+	err = cmd.Wait()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return output.Bytes(), ctxErr
+	}
+	return output.Bytes(), err
+}
+
+// scanLinesOrReturns is bufio.ScanLines that also splits on a bare '\r'.
+func scanLinesOrReturns(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		advance := i + 1
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			advance++
+		}
+		return advance, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+var ffmpegDurationRe = regexp.MustCompile(`Duration: (\d+:\d+:\d+(?:\.\d+)?)`)
+
+// ffmpegProgress follows the output of an ffmpeg run started with
+// "-progress pipe:1". The input duration comes from the banner ffmpeg prints
+// on stderr; the position from the out_time_us/out_time_ms keys.
+type ffmpegProgress struct {
+	duration time.Duration
+	report   ProgressFunc
+}
+
+func (p *ffmpegProgress) line(line string) {
+	if p.duration == 0 {
+		if m := ffmpegDurationRe.FindStringSubmatch(line); m != nil {
+			if d, err := ParseTimestamp(m[1]); err == nil {
+				p.duration = d
+			}
+			return
+		}
+	}
+
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok {
+		return
+	}
+	switch key {
+	// Despite its name, out_time_ms is in microseconds as well
+	case "out_time_us", "out_time_ms":
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || us < 0 {
+			return
+		}
+		p.report(time.Duration(us)*time.Microsecond, p.duration)
+	case "progress":
+		if value == "end" && p.duration > 0 {
+			p.report(p.duration, p.duration)
+		}
+	}
+}
+
+// whisperSegmentRe matches the per-segment lines whisper prints in verbose
+// mode, e.g. "[00:12.000 --> 00:15.500]  Hello there".
+var whisperSegmentRe = regexp.MustCompile(`^\[((?:\d+:)?\d+:\d+\.\d+) --> ((?:\d+:)?\d+:\d+\.\d+)\]`)
+
+// parseWhisperProgress returns the end time of the segment a verbose whisper
+// output line describes.
+func parseWhisperProgress(line string) (time.Duration, bool) {
+	m := whisperSegmentRe.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return 0, false
+	}
+	end, err := ParseTimestamp(m[2])
+	if err != nil {
+		return 0, false
+	}
+	return end, true
+}
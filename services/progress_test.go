@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressPercent(t *testing.T) {
+	tests := []struct {
+		p     Progress
+		known bool
+		want  int
+	}{
+		{Progress{}, false, 0},
+		{Progress{Position: 5 * time.Second, Duration: 20 * time.Second}, true, 25},
+		{Progress{Position: 30 * time.Second, Duration: 20 * time.Second}, true, 100},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.Known(); got != tt.known {
+			t.Errorf("%+v Known() = %v, want %v", tt.p, got, tt.known)
+		}
+		if got := tt.p.Percent(); got != tt.want {
+			t.Errorf("%+v Percent() = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestScanLinesOrReturns(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader("one\r\ntwo\rthree\nfour"))
+	scanner.Split(scanLinesOrReturns)
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	want := []string{"one", "two", "three", "four"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("Got lines %q, want %q", lines, want)
+	}
+}
+
+func TestRunCommandCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := runCommand(ctx, exec.Command("sleep", "60"), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the command to be killed, it ran for %v", elapsed)
+	}
+
+	// A wrapper script's child holds the pipes too
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = runCommand(ctx, exec.Command("sh", "-c", "sleep 60; echo done"), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the wrapper's child to be killed, it ran for %v", elapsed)
+	}
+}
+
+func TestFFmpegProgress(t *testing.T) {
+	type report struct{ position, total time.Duration }
+	var reports []report
+	p := &ffmpegProgress{report: func(position, total time.Duration) {
+		reports = append(reports, report{position, total})
+	}}
+
+	for _, line := range []string{
+		"  Duration: 00:01:40.50, start: 0.000000, bitrate: 1205 kb/s",
+		"frame=0",
+		"out_time_us=50250000",
+		"out_time_ms=N/A",
+		"progress=continue",
+		"progress=end",
+	} {
+		p.line(line)
+	}
+
+	want := []report{
+		{50250 * time.Millisecond, 100500 * time.Millisecond},
+		{100500 * time.Millisecond, 100500 * time.Millisecond},
+	}
+	if len(reports) != len(want) {
+		t.Fatalf("Got reports %v, want %v", reports, want)
+	}
+	for i := range want {
+		if reports[i] != want[i] {
+			t.Errorf("Report %d: got %v, want %v", i, reports[i], want[i])
+		}
+	}
+}
+
+func TestParseWhisperProgress(t *testing.T) {
+	tests := []struct {
+		line string
+		want time.Duration
+		ok   bool
+	}{
+		{"[00:12.000 --> 00:15.500]  Hello there", 15500 * time.Millisecond, true},
+		{"[01:02:03.000 --> 01:02:04.250]  Later on", time.Hour + 2*time.Minute + 4250*time.Millisecond, true},
+		{"Detecting language using up to the first 30 seconds.", 0, false},
+		{"Detected language: English", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseWhisperProgress(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseWhisperProgress(%q) = %v, %v; want %v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
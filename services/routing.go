@@ -0,0 +1,133 @@
+package services
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// AutoBackend is the backend choice that leaves it to the routing rules.
+const AutoBackend = "auto"
+
+// RouteDuration is a duration written like "10m" or "1h30m" in the routes
+// file.
+type RouteDuration time.Duration
+
+func (d *RouteDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = RouteDuration(parsed)
+	return nil
+}
+
+// RouteRule sends the jobs it matches to a chain of backends. Conditions
+// left empty match every job, except for Backend.
+type RouteRule struct {
+	// Backend matches the backend picked in the player. Empty matches only
+	// "auto", so a rule never overrides a backend the user chose.
+	Backend string `json:"backend,omitempty"`
+	// Language matches the language the job asked for. Jobs that let the
+	// backend detect it have none.
+	Language string `json:"language,omitempty"`
+	// MinDuration and MaxDuration bound the media's length. Media of
+	// unknown length matches neither.
+	MinDuration RouteDuration `json:"minDuration,omitempty"`
+	MaxDuration RouteDuration `json:"maxDuration,omitempty"`
+	// Backends are tried in order until one produces a transcript.
+	Backends []string `json:"backends"`
+}
+
+func (r RouteRule) matches(backend, language string, duration time.Duration) bool {
+	if want := cmp.Or(r.Backend, AutoBackend); want != backend {
+		return false
+	}
+	if r.Language != "" && !strings.EqualFold(r.Language, language) {
+		return false
+	}
+	if r.MinDuration > 0 && (duration == 0 || duration < time.Duration(r.MinDuration)) {
+		return false
+	}
+	if r.MaxDuration > 0 && (duration == 0 || duration > time.Duration(r.MaxDuration)) {
+		return false
+	}
+	return true
+}
+
+// Routes decide which backends a job is sent to, and in what order they are
+// tried when one fails.
+type Routes struct {
+	// Rules are checked in order; the first that matches a job decides.
+	Rules []RouteRule `json:"rules,omitempty"`
+	// Fallback is the chain for automatic jobs no rule matches.
+	Fallback []string `json:"fallback"`
+}
+
+// Route returns the chain of backends to try for a job. backend is the
+// player's choice: AutoBackend or a backend name. A named backend is only
+// routed by rules that name it; otherwise it is used alone.
+func (r *Routes) Route(backend, language string, duration time.Duration) []string {
+	if r == nil {
+		return []string{backend}
+	}
+	for _, rule := range r.Rules {
+		if rule.matches(backend, language, duration) {
+			return rule.Backends
+		}
+	}
+	if backend == AutoBackend {
+		return r.Fallback
+	}
+	return []string{backend}
+}
+
+// LoadRoutes reads routes from a JSON file and checks they name registered
+// backends, so it must be called after they are registered.
+func LoadRoutes(path string) (*Routes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var routes Routes
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("invalid routes file %s: %v", path, err)
+	}
+
+	if len(routes.Fallback) == 0 {
+		return nil, fmt.Errorf("routes file %s has no fallback chain", path)
+	}
+	if err := checkChain(routes.Fallback); err != nil {
+		return nil, fmt.Errorf("fallback: %v", err)
+	}
+	for i, rule := range routes.Rules {
+		if rule.Backend != "" && rule.Backend != AutoBackend {
+			if _, err := GetTranscriber(rule.Backend); err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i+1, err)
+			}
+		}
+		if len(rule.Backends) == 0 {
+			return nil, fmt.Errorf("rule %d has no backends", i+1)
+		}
+		if err := checkChain(rule.Backends); err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return &routes, nil
+}
+
+func checkChain(backends []string) error {
+	for _, name := range backends {
+		if _, err := GetTranscriber(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
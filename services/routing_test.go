@@ -0,0 +1,98 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoute(t *testing.T) {
+	routes := &Routes{
+		Rules: []RouteRule{
+			{Language: "de", Backends: []string{"team"}},
+			{Backend: AutoBackend, MaxDuration: RouteDuration(10 * time.Minute), Backends: []string{"whispercpp", "local"}},
+			{Backend: "local", Backends: []string{"local", "whispercpp"}},
+		},
+		Fallback: []string{"whispercpp", "local", "openai"},
+	}
+	tests := []struct {
+		name     string
+		backend  string
+		language string
+		duration time.Duration
+		want     []string
+	}{
+		{"Language", AutoBackend, "DE", time.Hour, []string{"team"}},
+		{"User's choice beats language", "openai", "de", 0, []string{"openai"}},
+		{"Short media", AutoBackend, "", 5 * time.Minute, []string{"whispercpp", "local"}},
+		{"Long media", AutoBackend, "", 2 * time.Hour, []string{"whispercpp", "local", "openai"}},
+		{"Unknown length", AutoBackend, "en", 0, []string{"whispercpp", "local", "openai"}},
+		{"User's choice with a rule", "local", "", time.Minute, []string{"local", "whispercpp"}},
+		{"User's choice alone", "openai", "en", time.Minute, []string{"openai"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routes.Route(tt.backend, tt.language, tt.duration); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	var none *Routes
+	if got := none.Route("local", "", 0); !reflect.DeepEqual(got, []string{"local"}) {
+		t.Errorf("Expected no routes to keep the choice, got %v", got)
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	RegisterTranscriber(stubTranscriber{name: "route-a"})
+	RegisterTranscriber(stubTranscriber{name: "route-b"})
+	defer func() {
+		transcribersMu.Lock()
+		delete(transcribers, "route-a")
+		delete(transcribers, "route-b")
+		transcribersMu.Unlock()
+	}()
+
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "routes.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	routes, err := LoadRoutes(write(`{
+		"rules": [{"backend": "auto", "minDuration": "1h30m", "backends": ["route-b"]}],
+		"fallback": ["route-a", "route-b"]
+	}`))
+	if err != nil {
+		t.Fatalf("LoadRoutes failed: %v", err)
+	}
+	if got := routes.Rules[0].MinDuration; time.Duration(got) != 90*time.Minute {
+		t.Errorf("Expected a 1h30m minimum, got %v", time.Duration(got))
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"No fallback", `{"rules": [{"backends": ["route-a"]}]}`, "no fallback chain"},
+		{"Unknown fallback", `{"fallback": ["route-a", "route-c"]}`, `fallback: unknown transcription backend "route-c"`},
+		{"Unknown rule backend", `{"rules": [{"backends": ["route-c"]}], "fallback": ["route-a"]}`, "rule 1: unknown"},
+		{"Empty rule", `{"rules": [{"language": "de"}], "fallback": ["route-a"]}`, "rule 1 has no backends"},
+		{"Bad duration", `{"rules": [{"maxDuration": 600, "backends": ["route-a"]}], "fallback": ["route-a"]}`, "like \"10m\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadRoutes(write(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
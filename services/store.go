@@ -0,0 +1,263 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Media is an uploaded video.
+type Media struct {
+	ID string `json:"id"`
+	// Filename is the name of the stored file inside the uploads directory.
+	Filename string `json:"filename"`
+	// OriginalName is the name the file had on the uploader's machine.
+	OriginalName string    `json:"originalName"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	CreatedAt    time.Time `json:"createdAt"`
+	// Info is the ffprobe result, taken when the upload was accepted.
+	Info *MediaInfo `json:"info,omitempty"`
+	// JobID is the most recently submitted transcription job.
+	JobID string `json:"jobId,omitempty"`
+	// TranscriptJobID is the most recent job that finished with a
+	// transcript. It is what the subtitle downloads serve.
+	TranscriptJobID string `json:"transcriptJobId,omitempty"`
+}
+
+// ErrMediaNotFound is returned by the Store for unknown media IDs.
+var ErrMediaNotFound = errors.New("media not found")
+
+var (
+	mediaBucket = []byte("media")
+	jobsBucket  = []byte("jobs")
+	// jobStatesBucket repeats each job's state, so lists can show it
+	// without decoding the job's transcript
+	jobStatesBucket = []byte("jobStates")
+)
+
+// Store is the embedded database that keeps uploads, jobs and their
+// transcripts, and the progress of resumable uploads, across restarts. It
+// implements JobStore.
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens or creates the database file at path.
+func OpenStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %v", err)
+	}
+	// The timeout stops a second server on the same file from hanging forever
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{mediaBucket, jobsBucket, jobStatesBucket, uploadsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise store: %v", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) CreateMedia(m *Media) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(mediaBucket)
+		if b.Get([]byte(m.ID)) != nil {
+			return fmt.Errorf("media %s already exists", m.ID)
+		}
+		return putJSON(b, m.ID, m)
+	})
+}
+
+func (s *Store) GetMedia(id string) (*Media, error) {
+	var m Media
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(mediaBucket), id, &m, ErrMediaNotFound)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// UpdateMedia applies change to the stored media in a single transaction.
+func (s *Store) UpdateMedia(id string, change func(*Media)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(mediaBucket)
+		var m Media
+		if err := getJSON(b, id, &m, ErrMediaNotFound); err != nil {
+			return err
+		}
+		change(&m)
+		return putJSON(b, id, &m)
+	})
+}
+
+// ListMedia returns every upload, newest first.
+func (s *Store) ListMedia() ([]*Media, error) {
+	var list []*Media
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(mediaBucket).ForEach(func(k, v []byte) error {
+			var m Media
+			if err := json.Unmarshal(v, &m); err != nil {
+				return fmt.Errorf("corrupt media %s: %v", k, err)
+			}
+			list = append(list, &m)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *Store) CreateJob(job *Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		if b.Get([]byte(job.ID)) != nil {
+			return fmt.Errorf("job %s already exists", job.ID)
+		}
+		return putJob(tx, job)
+	})
+}
+
+// putJob saves the job and its state.
+func putJob(tx *bolt.Tx, job *Job) error {
+	if err := putJSON(tx.Bucket(jobsBucket), job.ID, job); err != nil {
+		return err
+	}
+	return tx.Bucket(jobStatesBucket).Put([]byte(job.ID), []byte(job.State))
+}
+
+func (s *Store) GetJob(id string) (*Job, error) {
+	var job Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(jobsBucket), id, &job, ErrJobNotFound)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// UpdateJob saves the job. A job done with a transcript becomes its media's
+// current transcript in the same transaction, so the media never points at
+// a job whose transcript isn't saved yet.
+// GetJobState returns just the job's state, which is much cheaper than
+// GetJob for a job with a long transcript.
+func (s *Store) GetJobState(id string) (JobState, error) {
+	var state JobState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(jobStatesBucket).Get([]byte(id)); v != nil {
+			state = JobState(v)
+			return nil
+		}
+		// Jobs saved before states were kept on their own
+		var job Job
+		if err := getJSON(tx.Bucket(jobsBucket), id, &job, ErrJobNotFound); err != nil {
+			return err
+		}
+		state = job.State
+		return nil
+	})
+	return state, err
+}
+
+func (s *Store) UpdateJob(job *Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		if b.Get([]byte(job.ID)) == nil {
+			return ErrJobNotFound
+		}
+		if err := putJob(tx, job); err != nil {
+			return err
+		}
+		if job.State != JobDone || job.Transcript == nil || job.MediaID == "" {
+			return nil
+		}
+		mb := tx.Bucket(mediaBucket)
+		var m Media
+		if err := getJSON(mb, job.MediaID, &m, ErrMediaNotFound); errors.Is(err, ErrMediaNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		m.TranscriptJobID = job.ID
+		return putJSON(mb, m.ID, &m)
+	})
+}
+
+// FailUnfinishedJobs marks every job that was queued or running as failed.
+// Workers don't survive a restart, so call it at startup before new jobs
+// are submitted. It returns how many jobs were changed.
+func (s *Store) FailUnfinishedJobs(reason string) (int, error) {
+	count := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		// Collect first; a bucket must not be modified while iterating it
+		var unfinished []*Job
+		err := b.ForEach(func(k, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("corrupt job %s: %v", k, err)
+			}
+			if !job.Finished() {
+				unfinished = append(unfinished, &job)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, job := range unfinished {
+			job.State = JobFailed
+			job.Error = reason
+			job.UpdatedAt = time.Now()
+			if err := putJob(tx, job); err != nil {
+				return err
+			}
+		}
+		count = len(unfinished)
+		return nil
+	})
+	return count, err
+}
+
+func putJSON(b *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+func getJSON(b *bolt.Bucket, key string, v interface{}, notFound error) error {
+	data := b.Get([]byte(key))
+	if data == nil {
+		return notFound
+	}
+	return json.Unmarshal(data, v)
+}
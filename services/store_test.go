@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	return s
+}
+
+func TestStoreMedia(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "test.db"))
+	defer s.Close()
+
+	now := time.Now()
+	older := &Media{ID: "older", Filename: "older.mp4", CreatedAt: now.Add(-time.Hour)}
+	newer := &Media{ID: "newer", Filename: "newer.mp4", CreatedAt: now}
+	for _, m := range []*Media{older, newer} {
+		if err := s.CreateMedia(m); err != nil {
+			t.Fatalf("CreateMedia failed: %v", err)
+		}
+	}
+	if err := s.CreateMedia(older); err == nil {
+		t.Error("Expected error creating duplicate media")
+	}
+
+	if err := s.UpdateMedia("older", func(m *Media) { m.JobID = "job1" }); err != nil {
+		t.Fatalf("UpdateMedia failed: %v", err)
+	}
+	got, err := s.GetMedia("older")
+	if err != nil {
+		t.Fatalf("GetMedia failed: %v", err)
+	}
+	if got.JobID != "job1" || got.Filename != "older.mp4" {
+		t.Errorf("Unexpected media %+v", got)
+	}
+
+	if _, err := s.GetMedia("missing"); !errors.Is(err, ErrMediaNotFound) {
+		t.Errorf("Expected ErrMediaNotFound, got %v", err)
+	}
+	if err := s.UpdateMedia("missing", func(*Media) {}); !errors.Is(err, ErrMediaNotFound) {
+		t.Errorf("Expected ErrMediaNotFound, got %v", err)
+	}
+
+	list, err := s.ListMedia()
+	if err != nil {
+		t.Fatalf("ListMedia failed: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != "newer" || list[1].ID != "older" {
+		t.Errorf("Expected newest first, got %+v", list)
+	}
+}
+
+func TestStoreJobsSurviveReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "test.db")
+	s := openTestStore(t, path)
+
+	done := &Job{
+		ID:    "done",
+		State: JobDone,
+		Transcript: &Transcript{Segments: []Segment{
+			{Start: time.Second, End: 2 * time.Second, Text: "Hello"},
+		}},
+	}
+	running := &Job{ID: "running", State: JobTranscribing}
+	for _, job := range []*Job{done, running} {
+		if err := s.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob failed: %v", err)
+		}
+	}
+	if err := s.UpdateJob(&Job{ID: "missing"}); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	s = openTestStore(t, path)
+	defer s.Close()
+
+	n, err := s.FailUnfinishedJobs("restarted")
+	if err != nil {
+		t.Fatalf("FailUnfinishedJobs failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 job to be failed, got %d", n)
+	}
+
+	got, err := s.GetJob("done")
+	if err != nil {
+		t.Fatalf("GetJob failed: %v", err)
+	}
+	if got.State != JobDone || got.Transcript == nil || got.Transcript.Segments[0].End != 2*time.Second {
+		t.Errorf("Done job did not survive reopen: %+v", got)
+	}
+
+	got, err = s.GetJob("running")
+	if err != nil {
+		t.Fatalf("GetJob failed: %v", err)
+	}
+	if got.State != JobFailed || got.Error != "restarted" {
+		t.Errorf("Expected interrupted job to be failed, got %+v", got)
+	}
+}
+
+func TestStoreJobDoneUpdatesMedia(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "test.db"))
+	defer s.Close()
+	if err := s.CreateMedia(&Media{ID: "video", TranscriptJobID: "old"}); err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{ID: "new", MediaID: "video", State: JobQueued}
+	if err := s.CreateJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// The previous transcript stays current until the new one is saved
+	job.State = JobTranscribing
+	if err := s.UpdateJob(job); err != nil {
+		t.Fatalf("UpdateJob failed: %v", err)
+	}
+	if m, _ := s.GetMedia("video"); m.TranscriptJobID != "old" {
+		t.Errorf("Expected the old transcript while running, got %q", m.TranscriptJobID)
+	}
+
+	job.State = JobDone
+	job.Transcript = &Transcript{Segments: []Segment{{Text: "Hello"}}}
+	if err := s.UpdateJob(job); err != nil {
+		t.Fatalf("UpdateJob failed: %v", err)
+	}
+	if m, _ := s.GetMedia("video"); m.TranscriptJobID != "new" {
+		t.Errorf("Expected the done job to be current, got %q", m.TranscriptJobID)
+	}
+
+	// Jobs of media that is gone still save
+	orphan := &Job{ID: "orphan", MediaID: "gone", State: JobQueued}
+	if err := s.CreateJob(orphan); err != nil {
+		t.Fatal(err)
+	}
+	orphan.State, orphan.Transcript = JobDone, &Transcript{}
+	if err := s.UpdateJob(orphan); err != nil {
+		t.Errorf("Expected a job without media to save, got %v", err)
+	}
+}
+
+func TestStoreGetJobState(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "test.db"))
+	defer s.Close()
+	job := &Job{ID: "job", State: JobQueued}
+	if err := s.CreateJob(job); err != nil {
+		t.Fatal(err)
+	}
+	job.State = JobDone
+	if err := s.UpdateJob(job); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := s.GetJobState("job"); err != nil || state != JobDone {
+		t.Errorf("Expected done, got %q, %v", state, err)
+	}
+
+	// A job saved before states were kept on their own
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(jobsBucket), "legacy", &Job{ID: "legacy", State: JobFailed})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, err := s.GetJobState("legacy"); err != nil || state != JobFailed {
+		t.Errorf("Expected failed, got %q, %v", state, err)
+	}
+	if _, err := s.GetJobState("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Segment is a single timed piece of a transcript.
+type Segment struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	Text  string        `json:"text"`
+	// Words are the segment's words with their own timings, for backends
+	// with Capabilities.WordTimings.
+	Words []Word `json:"words,omitempty"`
+	// Confidence is the decoder's view of the segment, for backends that
+	// report it.
+	Confidence *Confidence `json:"confidence,omitempty"`
+}
+
+// Confidence is whisper's per-segment decoding data. See WhisperSegment for
+// what the values mean.
+type Confidence struct {
+	AvgLogProb       float64 `json:"avgLogprob"`
+	NoSpeechProb     float64 `json:"noSpeechProb"`
+	CompressionRatio float64 `json:"compressionRatio"`
+	Temperature      float64 `json:"temperature"`
+}
+
+// Doubtful reports whether whisper would have judged the segment a failed
+// decode or likely not speech, using the thresholds of its CLI.
+func (c *Confidence) Doubtful() bool {
+	if c == nil {
+		return false
+	}
+	return c.AvgLogProb < -1 || c.CompressionRatio > 2.4 || c.NoSpeechProb > 0.6
+}
+
+// Word is a single timed word. Its text is trimmed of the spacing around it.
+type Word struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	Text  string        `json:"text"`
+	// Probability is the model's confidence in the word, from 0 to 1, or 0
+	// when the backend doesn't report it.
+	Probability float64 `json:"probability,omitempty"`
+}
+
+// Shift moves the segment and its words later by offset.
+func (s *Segment) Shift(offset time.Duration) {
+	s.Start += offset
+	s.End += offset
+	for i := range s.Words {
+		s.Words[i].Start += offset
+		s.Words[i].End += offset
+	}
+}
+
+// Transcript is the timed result of transcribing one audio file.
+type Transcript struct {
+	Segments []Segment `json:"segments"`
+	// Language is the spoken language as the backend names it, when it says.
+	Language string `json:"language,omitempty"`
+}
+
+// Text joins the segment texts into a single plain-text transcript.
+func (t *Transcript) Text() string {
+	parts := make([]string, 0, len(t.Segments))
+	for _, seg := range t.Segments {
+		if text := strings.TrimSpace(seg.Text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// FormatTimestamp renders d as HH:MM:SS.mmm using sep between the seconds
+// and milliseconds (SRT uses ',' and WebVTT uses '.').
+func FormatTimestamp(d time.Duration, sep string) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	h := ms / 3600000
+	ms -= h * 3600000
+	m := ms / 60000
+	ms -= m * 60000
+	s := ms / 1000
+	ms -= s * 1000
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, sep, ms)
+}
+
+// WriteSRT writes the segments to w in SubRip (.srt) format.
+func WriteSRT(w io.Writer, segments []Segment) error {
+	bw := bufio.NewWriter(w)
+	n := 0
+	for _, seg := range segments {
+		text := strings.TrimSpace(seg.Text)
+		if text == "" {
+			continue
+		}
+		// A blank line terminates an SRT cue, so collapse any inside the text
+		text = collapseBlankLines(text)
+		n++
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n\n", n,
+			FormatTimestamp(seg.Start, ","), FormatTimestamp(seg.End, ","), text)
+	}
+	return bw.Flush()
+}
+
+// ParseSRT reads SubRip cues from r. Cue numbers are ignored; cues are
+// returned in file order.
+func ParseSRT(r io.Reader) ([]Segment, error) {
+	var segments []Segment
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var current *Segment
+	var lines []string
+	flush := func() {
+		if current != nil {
+			current.Text = strings.Join(lines, "\n")
+			segments = append(segments, *current)
+		}
+		current = nil
+		lines = nil
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		line = strings.TrimPrefix(line, "\ufeff")
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case strings.Contains(line, "-->"):
+			flush()
+			start, end, err := parseTimingLine(line)
+			if err != nil {
+				return nil, err
+			}
+			current = &Segment{Start: start, End: end}
+		case current != nil:
+			lines = append(lines, line)
+		}
+		// Anything else is a cue number and carries no information
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return segments, nil
+}
+
+// parseTimingLine parses "00:00:01,000 --> 00:00:02,500" plus any trailing
+// cue settings, which are ignored.
+func parseTimingLine(line string) (time.Duration, time.Duration, error) {
+	left, right, _ := strings.Cut(line, "-->")
+	fields := strings.Fields(right)
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("invalid cue timing %q", line)
+	}
+	start, err := ParseTimestamp(strings.TrimSpace(left))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := ParseTimestamp(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// ParseTimestamp parses subtitle timestamps of the form [HH:]MM:SS[.,]mmm.
+func ParseTimestamp(ts string) (time.Duration, error) {
+	ts = strings.Replace(ts, ",", ".", 1)
+	parts := strings.Split(ts, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", ts)
+	}
+
+	var total time.Duration
+	for i, part := range parts[:len(parts)-1] {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", ts)
+		}
+		unit := time.Minute
+		if len(parts) == 3 && i == 0 {
+			unit = time.Hour
+		}
+		total += time.Duration(n) * unit
+	}
+
+	secs, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || secs < 0 {
+		return 0, fmt.Errorf("invalid timestamp %q", ts)
+	}
+	return total + secondsToDuration(secs), nil
+}
+
+// secondsToDuration converts fractional seconds to a Duration rounded to the
+// nearest millisecond, which is the precision every subtitle format uses.
+func secondsToDuration(secs float64) time.Duration {
+	return time.Duration(secs*1000+0.5) * time.Millisecond
+}
+
+func collapseBlankLines(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
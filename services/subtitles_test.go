@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		sep  string
+		want string
+	}{
+		{0, ",", "00:00:00,000"},
+		{1500 * time.Millisecond, ",", "00:00:01,500"},
+		{time.Hour + 2*time.Minute + 3*time.Second + 45*time.Millisecond, ".", "01:02:03.045"},
+		{-time.Second, ",", "00:00:00,000"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatTimestamp(tt.d, tt.sep); got != tt.want {
+			t.Errorf("FormatTimestamp(%v, %q) = %q, want %q", tt.d, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestWriteSRT(t *testing.T) {
+	segments := []Segment{
+		{Start: 0, End: 1500 * time.Millisecond, Text: " Hello there. "},
+		{Start: 1500 * time.Millisecond, End: 2 * time.Second, Text: "   "},
+		{Start: 2 * time.Second, End: 4 * time.Second, Text: "Line one\n\nLine two"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSRT(&buf, segments); err != nil {
+		t.Fatalf("WriteSRT failed: %v", err)
+	}
+
+	expected := "1\n00:00:00,000 --> 00:00:01,500\nHello there.\n\n" +
+		"2\n00:00:02,000 --> 00:00:04,000\nLine one\nLine two\n\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected SRT output:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestParseSRT(t *testing.T) {
+	input := "\ufeff1\r\n00:00:00,000 --> 00:00:01,500\r\nHello\r\nthere\r\n\r\n" +
+		"2\n00:01:02,250 --> 00:01:03,000\nAgain\n"
+
+	segments, err := ParseSRT(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseSRT failed: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(segments))
+	}
+	if segments[0].Text != "Hello\nthere" {
+		t.Errorf("Unexpected first segment text %q", segments[0].Text)
+	}
+	if segments[1].Start != time.Minute+2250*time.Millisecond || segments[1].End != time.Minute+3*time.Second {
+		t.Errorf("Unexpected second segment timing: %+v", segments[1])
+	}
+}
+
+func TestParseSRTRoundTrip(t *testing.T) {
+	segments := []Segment{
+		{Start: 250 * time.Millisecond, End: time.Second, Text: "One"},
+		{Start: time.Second, End: 3*time.Second + 999*time.Millisecond, Text: "Two"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSRT(&buf, segments); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSRT(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(segments) {
+		t.Fatalf("Expected %d segments, got %d", len(segments), len(parsed))
+	}
+	for i := range segments {
+		if !reflect.DeepEqual(parsed[i], segments[i]) {
+			t.Errorf("Segment %d: got %+v, want %+v", i, parsed[i], segments[i])
+		}
+	}
+}
+
+func TestParseSRTInvalidTiming(t *testing.T) {
+	_, err := ParseSRT(strings.NewReader("1\nnot a time --> 00:00:01,000\nText\n"))
+	if err == nil {
+		t.Error("Expected error for invalid timing, got nil")
+	}
+}
+
+func TestSegmentShift(t *testing.T) {
+	seg := Segment{Start: time.Second, End: 2 * time.Second, Text: "hi there", Words: []Word{
+		{Start: time.Second, End: 1500 * time.Millisecond, Text: "hi"},
+		{Start: 1500 * time.Millisecond, End: 2 * time.Second, Text: "there"},
+	}}
+	seg.Shift(time.Minute)
+	if seg.Start != 61*time.Second || seg.End != 62*time.Second {
+		t.Errorf("Expected the segment at 61s-62s, got %v-%v", seg.Start, seg.End)
+	}
+	if seg.Words[1].Start != 61500*time.Millisecond || seg.Words[1].End != 62*time.Second {
+		t.Errorf("Expected the words to move with the segment, got %+v", seg.Words)
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// ToolCheck is what the startup self-check found out about an external tool.
+type ToolCheck struct {
+	Name string
+	// Path is the command that runs the tool, or the server's URL.
+	Path string
+	// Version is the tool's own report of its version, when it gives one.
+	Version string
+	// Err is set when the tool is missing or doesn't run.
+	Err error
+}
+
+func (c ToolCheck) String() string {
+	switch {
+	case c.Err != nil:
+		return c.Name + ": " + c.Err.Error()
+	case c.Version != "":
+		return c.Name + ": " + c.Path + " (" + c.Version + ")"
+	default:
+		return c.Name + ": " + c.Path
+	}
+}
+
+// ToolChecker is implemented by backends that depend on an external tool,
+// so the self-check can report on it.
+type ToolChecker interface {
+	CheckTool() ToolCheck
+}
+
+// CheckTools reports on ffmpeg, ffprobe and the tool behind each backend
+// that has one.
+func CheckTools(backends []Transcriber) []ToolCheck {
+	checks := []ToolCheck{
+		CheckTool("ffmpeg", "-version"),
+		CheckTool("ffprobe", "-version"),
+	}
+	for _, b := range backends {
+		if checker, ok := b.(ToolChecker); ok {
+			checks = append(checks, checker.CheckTool())
+		}
+	}
+	return checks
+}
+
+// CheckTool looks name up in PATH and runs it with versionArgs, taking the
+// first line it prints as the version.
+func CheckTool(name string, versionArgs ...string) ToolCheck {
+	check := ToolCheck{Name: name}
+	path, err := execLookPath(name)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	check.Path = path
+	check.Version, check.Err = toolVersion(append([]string{path}, versionArgs...))
+	return check
+}
+
+// toolVersion runs command and returns the first line of its output.
+func toolVersion(command []string) (string, error) {
+	output, err := execCommand(command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// scriptInterpreter returns the interpreter in a script's #! line, e.g. the
+// virtualenv's python for a pip-installed CLI, or "" if it has none.
+func scriptInterpreter(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	// #!/usr/bin/env python3 names the interpreter second
+	if len(fields) > 1 && strings.HasSuffix(fields[0], "/env") {
+		return fields[1]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestHelperProcessTools isn't a real test. It stands in for the tools the
+// self-check and FindWhisper run.
+func TestHelperProcessTools(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+	cmd := filepath.Base(args[0])
+	switch {
+	case strings.HasPrefix(cmd, "python") && len(args) == 3 && args[2] == "import whisper":
+		os.Exit(0)
+	case strings.HasPrefix(cmd, "python") && len(args) == 3 && args[2] == whisperVersionScript:
+		fmt.Println("20240930")
+		os.Exit(0)
+	case len(args) == 2 && args[1] == "-version":
+		fmt.Printf("%s version 6.1.1 Copyright (c) 2000-2023 the FFmpeg developers\n", cmd)
+		fmt.Println("built with gcc 13")
+		os.Exit(0)
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n", cmd)
+	os.Exit(1)
+}
+
+// mockTools swaps execCommand for TestHelperProcessTools and execLookPath for
+// a PATH holding only the given commands.
+func mockTools(t *testing.T, inPath ...string) {
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcessTools", "--", name}
+		cs = append(cs, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+	execLookPath = func(file string) (string, error) {
+		for _, name := range inPath {
+			if name == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		if filepath.IsAbs(file) {
+			return file, nil
+		}
+		return "", exec.ErrNotFound
+	}
+	t.Cleanup(func() {
+		execCommand = exec.Command
+		execLookPath = exec.LookPath
+	})
+}
+
+func TestCheckTools(t *testing.T) {
+	mockTools(t, "ffmpeg")
+	dir := t.TempDir()
+	script := filepath.Join(dir, "whisper")
+	if err := os.WriteFile(script, []byte("#!/opt/venv/bin/python3.11\nimport whisper\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := CheckTools([]Transcriber{LocalWhisper{Command: []string{script}}, OpenAI{}})
+	var got []string
+	for _, c := range checks {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"ffmpeg: /usr/bin/ffmpeg (ffmpeg version 6.1.1 Copyright (c) 2000-2023 the FFmpeg developers)",
+		"ffprobe: " + exec.ErrNotFound.Error(),
+		"whisper: " + script + " (openai-whisper 20240930)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected\n%q\ngot\n%q", want, got)
+	}
+	if !errors.Is(checks[1].Err, exec.ErrNotFound) {
+		t.Errorf("Expected ffprobe to be missing, got %v", checks[1].Err)
+	}
+}
+
+func TestScriptInterpreter(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"#!/home/me/.venv/bin/python\nimport sys\n", "/home/me/.venv/bin/python"},
+		{"#!/usr/bin/env python3\nimport sys\n", "python3"},
+		{"\x7fELF", ""},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(path, []byte(tt.content), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if got := scriptInterpreter(path); got != tt.want {
+			t.Errorf("scriptInterpreter(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
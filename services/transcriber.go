@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities describes what a transcription backend can produce.
+type Capabilities struct {
+	// Timestamps is true when segments carry real start and end times.
+	Timestamps bool
+	// WordTimings is true when the backend can time individual words.
+	WordTimings bool
+	// Languages lists the supported ISO 639-1 codes. Empty means the
+	// backend accepts any language whisper knows and can detect it.
+	Languages []string
+	// Audio is the format the backend wants audio extracted in. The zero
+	// value means ProfileWAV.
+	Audio AudioProfile
+	// Models lists the models a job can pick. Empty means the backend has
+	// a single model.
+	Models []string
+	// ComputeTypes lists the precisions a job can run the model at, e.g.
+	// int8 for speed or float32 for accuracy. Empty means the backend has
+	// no choice.
+	ComputeTypes []string
+}
+
+// SupportsModel reports whether model can be requested. An empty model
+// means the backend's default and is always supported.
+func (c Capabilities) SupportsModel(model string) bool {
+	if model == "" {
+		return true
+	}
+	for _, m := range c.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsComputeType reports whether computeType can be requested. An
+// empty computeType means the backend's default and is always supported.
+func (c Capabilities) SupportsComputeType(computeType string) bool {
+	if computeType == "" {
+		return true
+	}
+	for _, t := range c.ComputeTypes {
+		if t == computeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary is a short human-readable description of the capabilities.
+func (c Capabilities) Summary() string {
+	var parts []string
+	if c.Timestamps {
+		parts = append(parts, "timestamps")
+	}
+	if c.WordTimings {
+		parts = append(parts, "word timings")
+	}
+	if len(c.Languages) == 0 {
+		parts = append(parts, "any language")
+	} else {
+		parts = append(parts, strings.Join(c.Languages, "/"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SupportsLanguage reports whether lang can be requested. An empty lang
+// means auto-detect and is always supported.
+func (c Capabilities) SupportsLanguage(lang string) bool {
+	if lang == "" || len(c.Languages) == 0 {
+		return true
+	}
+	for _, l := range c.Languages {
+		if strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// TranscribeOptions are the per-request settings passed to a Transcriber.
+type TranscribeOptions struct {
+	// Language is an ISO 639-1 code; empty lets the backend detect it.
+	Language string `json:"language,omitempty"`
+	// Model is one of the backend's Capabilities.Models; empty uses its
+	// default.
+	Model string `json:"model,omitempty"`
+	// Prompt is text in the style of the audio, such as names and jargon
+	// it contains, to steer the spelling of the transcript.
+	Prompt string `json:"prompt,omitempty"`
+	// Temperature is the sampling temperature from 0 to 1. 0 leaves the
+	// backend's own, which falls back to higher temperatures as needed.
+	Temperature float64 `json:"temperature,omitempty"`
+	// BeamSize is how many candidate transcriptions are kept while
+	// decoding: more is slower but more accurate. 0 leaves the backend's.
+	BeamSize int `json:"beamSize,omitempty"`
+	// ComputeType is one of the backend's Capabilities.ComputeTypes; empty
+	// uses its default.
+	ComputeType string `json:"computeType,omitempty"`
+	// Progress, if set, is told how far into the audio the backend has got.
+	// Backends that can't tell leave it uncalled.
+	Progress func(position time.Duration) `json:"-"`
+}
+
+// Transcriber turns an audio file into a timed transcript.
+type Transcriber interface {
+	// Name is the registry key, also used as the form value in the UI.
+	Name() string
+	// Description is a short label shown to users.
+	Description() string
+	Capabilities() Capabilities
+	Transcribe(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error)
+}
+
+var (
+	transcribersMu sync.RWMutex
+	transcribers   = make(map[string]Transcriber)
+)
+
+// RegisterTranscriber makes a backend available by name. Like
+// database/sql.Register it panics if t is nil or the name is taken.
+func RegisterTranscriber(t Transcriber) {
+	transcribersMu.Lock()
+	defer transcribersMu.Unlock()
+	if t == nil {
+		panic("services: RegisterTranscriber transcriber is nil")
+	}
+	if _, dup := transcribers[t.Name()]; dup {
+		panic("services: RegisterTranscriber called twice for " + t.Name())
+	}
+	transcribers[t.Name()] = t
+}
+
+// GetTranscriber returns the registered backend with the given name.
+func GetTranscriber(name string) (Transcriber, error) {
+	transcribersMu.RLock()
+	defer transcribersMu.RUnlock()
+	t, ok := transcribers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown transcription backend %q", name)
+	}
+	return t, nil
+}
+
+// Transcribers returns every registered backend sorted by name.
+func Transcribers() []Transcriber {
+	transcribersMu.RLock()
+	defer transcribersMu.RUnlock()
+	list := make([]Transcriber, 0, len(transcribers))
+	for _, t := range transcribers {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
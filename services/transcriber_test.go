@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+type stubTranscriber struct {
+	name string
+	caps Capabilities
+}
+
+func (s stubTranscriber) Name() string               { return s.name }
+func (s stubTranscriber) Description() string        { return "Stub " + s.name }
+func (s stubTranscriber) Capabilities() Capabilities { return s.caps }
+
+func (s stubTranscriber) Transcribe(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	return &Transcript{Segments: []Segment{{Text: s.name}}}, nil
+}
+
+func TestRegisterTranscriber(t *testing.T) {
+	defer func() {
+		transcribersMu.Lock()
+		delete(transcribers, "stub-b")
+		delete(transcribers, "stub-a")
+		transcribersMu.Unlock()
+	}()
+
+	RegisterTranscriber(stubTranscriber{name: "stub-b"})
+	RegisterTranscriber(stubTranscriber{name: "stub-a"})
+
+	got, err := GetTranscriber("stub-a")
+	if err != nil {
+		t.Fatalf("GetTranscriber failed: %v", err)
+	}
+	if got.Name() != "stub-a" {
+		t.Errorf("Expected stub-a, got %s", got.Name())
+	}
+
+	if _, err := GetTranscriber("missing"); err == nil {
+		t.Error("Expected error for unknown backend, got nil")
+	}
+
+	var names []string
+	for _, tr := range Transcribers() {
+		if tr.Name() == "stub-a" || tr.Name() == "stub-b" {
+			names = append(names, tr.Name())
+		}
+	}
+	if len(names) != 2 || names[0] != "stub-a" || names[1] != "stub-b" {
+		t.Errorf("Expected sorted [stub-a stub-b], got %v", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on duplicate registration")
+		}
+	}()
+	RegisterTranscriber(stubTranscriber{name: "stub-a"})
+}
+
+func TestCapabilities(t *testing.T) {
+	anyLang := Capabilities{Timestamps: true}
+	if !anyLang.SupportsLanguage("fr") || !anyLang.SupportsLanguage("") {
+		t.Error("Expected a backend without a language list to accept any language")
+	}
+	if got := anyLang.Summary(); got != "timestamps, any language" {
+		t.Errorf("Unexpected summary %q", got)
+	}
+
+	english := Capabilities{Timestamps: true, WordTimings: true, Languages: []string{"en"}}
+	if !english.SupportsLanguage("EN") {
+		t.Error("Expected language match to ignore case")
+	}
+	if english.SupportsLanguage("de") {
+		t.Error("Expected de to be unsupported")
+	}
+	if got := english.Summary(); got != "timestamps, word timings, en" {
+		t.Errorf("Unexpected summary %q", got)
+	}
+
+	if !english.SupportsModel("") || english.SupportsModel("large") {
+		t.Error("Expected a backend without models to only accept the default")
+	}
+	models := Capabilities{Models: OpenAIModels}
+	if !models.SupportsModel("whisper-1") || models.SupportsModel("Whisper-1") || models.SupportsModel("gpt-4o-transcribe") {
+		t.Error("Expected model names to match exactly")
+	}
+
+	if !english.SupportsComputeType("") || english.SupportsComputeType("int8") {
+		t.Error("Expected a backend without compute types to only accept the default")
+	}
+	if !(Capabilities{ComputeTypes: FasterWhisperComputeTypes}).SupportsComputeType("float32") {
+		t.Error("Expected float32 to be supported")
+	}
+}
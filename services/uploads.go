@@ -0,0 +1,254 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Upload is a resumable upload that has not been completed yet. Its data is
+// appended chunk by chunk to a partial file until Offset reaches Length.
+type Upload struct {
+	ID string `json:"id"`
+	// Filename is the name the file has on the uploader's machine.
+	Filename  string    `json:"filename"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Complete reports whether every byte of the upload has been received.
+func (u *Upload) Complete() bool {
+	return u.Offset >= u.Length
+}
+
+var (
+	// ErrUploadNotFound is returned for unknown or expired upload IDs.
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadOffset is returned when a chunk doesn't start where the
+	// previous one ended.
+	ErrUploadOffset = errors.New("upload offset does not match")
+	// ErrUploadBusy is returned when a chunk arrives for, or a delete is
+	// asked of, an upload that is still receiving another chunk.
+	ErrUploadBusy = errors.New("upload is already receiving data")
+)
+
+var uploadsBucket = []byte("uploads")
+
+// Uploads assembles resumable uploads. Progress is kept in the Store, so an
+// upload can be resumed after a disconnect or a server restart.
+type Uploads struct {
+	store *Store
+	dir   string
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// NewUploads keeps the partial files of unfinished uploads in dir.
+func NewUploads(store *Store, dir string) *Uploads {
+	return &Uploads{store: store, dir: dir, active: make(map[string]bool)}
+}
+
+func (u *Uploads) partPath(id string) string {
+	return filepath.Join(u.dir, id+".part")
+}
+
+// Create starts an upload of length bytes.
+func (u *Uploads) Create(filename string, length int64) (*Upload, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("invalid upload length %d", length)
+	}
+	id, err := NewID()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(u.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload dir: %v", err)
+	}
+	f, err := os.Create(u.partPath(id))
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	now := time.Now()
+	upload := &Upload{ID: id, Filename: filename, Length: length, CreatedAt: now, UpdatedAt: now}
+	if err := u.store.putUpload(upload); err != nil {
+		os.Remove(u.partPath(id))
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Get returns the current state of an upload.
+func (u *Uploads) Get(id string) (*Upload, error) {
+	return u.store.getUpload(id)
+}
+
+// Append writes the chunk read from r at offset, which must be the upload's
+// current offset. Whatever was received before r fails is kept, so the client
+// can resume from the returned offset. Data past the declared length is not
+// read.
+func (u *Uploads) Append(id string, offset int64, r io.Reader) (*Upload, error) {
+	if !u.lock(id) {
+		return nil, ErrUploadBusy
+	}
+	defer u.unlock(id)
+
+	upload, err := u.store.getUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrUploadOffset
+	}
+
+	f, err := os.OpenFile(u.partPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Drop anything written past the recorded offset before a crash
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	n, copyErr := io.Copy(f, io.LimitReader(r, upload.Length-offset))
+	if err := f.Close(); copyErr == nil {
+		copyErr = err
+	}
+
+	upload.Offset += n
+	upload.UpdatedAt = time.Now()
+	if err := u.store.putUpload(upload); err != nil {
+		return nil, err
+	}
+	return upload, copyErr
+}
+
+// lock marks the upload as in use, or reports false if it already is.
+func (u *Uploads) lock(id string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.active[id] {
+		return false
+	}
+	u.active[id] = true
+	return true
+}
+
+func (u *Uploads) unlock(id string) {
+	u.mu.Lock()
+	delete(u.active, id)
+	u.mu.Unlock()
+}
+
+// Finish moves the data of a complete upload to dest and forgets the upload.
+func (u *Uploads) Finish(id, dest string) error {
+	if !u.lock(id) {
+		return ErrUploadBusy
+	}
+	defer u.unlock(id)
+	upload, err := u.store.getUpload(id)
+	if err != nil {
+		return err
+	}
+	if !upload.Complete() {
+		return fmt.Errorf("upload %s is incomplete: %d of %d bytes", id, upload.Offset, upload.Length)
+	}
+	if err := os.Rename(u.partPath(id), dest); err != nil {
+		return err
+	}
+	return u.store.deleteUpload(id)
+}
+
+// Delete abandons an upload and removes its data. An upload that is
+// receiving a chunk is left alone with ErrUploadBusy.
+func (u *Uploads) Delete(id string) error {
+	if !u.lock(id) {
+		return ErrUploadBusy
+	}
+	defer u.unlock(id)
+	if _, err := u.store.getUpload(id); err != nil {
+		return err
+	}
+	if err := os.Remove(u.partPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return u.store.deleteUpload(id)
+}
+
+// Expire deletes uploads that have not received data for maxAge, and
+// returns how many were removed.
+func (u *Uploads) Expire(maxAge time.Duration) (int, error) {
+	list, err := u.store.listUploads()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, upload := range list {
+		if time.Since(upload.UpdatedAt) < maxAge {
+			continue
+		}
+		// Uploads receiving data right now aren't abandoned
+		err := u.Delete(upload.ID)
+		if errors.Is(err, ErrUploadBusy) || errors.Is(err, ErrUploadNotFound) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s *Store) putUpload(upload *Upload) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(uploadsBucket), upload.ID, upload)
+	})
+}
+
+func (s *Store) getUpload(id string) (*Upload, error) {
+	var upload Upload
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(uploadsBucket), id, &upload, ErrUploadNotFound)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (s *Store) deleteUpload(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadsBucket).Delete([]byte(id))
+	})
+}
+
+func (s *Store) listUploads() ([]*Upload, error) {
+	var list []*Upload
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(uploadsBucket).ForEach(func(k, v []byte) error {
+			var upload Upload
+			if err := json.Unmarshal(v, &upload); err != nil {
+				return fmt.Errorf("corrupt upload %s: %v", k, err)
+			}
+			list = append(list, &upload)
+			return nil
+		})
+	})
+	return list, err
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingReader returns its data and then a dropped-connection error.
+type failingReader struct{ r io.Reader }
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestUploadsResume(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, filepath.Join(dir, "test.db"))
+	defer s.Close()
+	u := NewUploads(s, filepath.Join(dir, "partial"))
+
+	upload, err := u.Create("talk.mp4", 11)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// The first chunk is cut off; what arrived is kept
+	upload, err = u.Append(upload.ID, 0, failingReader{strings.NewReader("hello")})
+	if err == nil || upload == nil || upload.Offset != 5 {
+		t.Fatalf("Expected a partial chunk at offset 5, got %+v, %v", upload, err)
+	}
+
+	// A server restart keeps the progress
+	if _, err := u.Append(upload.ID, 0, strings.NewReader("hello")); !errors.Is(err, ErrUploadOffset) {
+		t.Errorf("Expected ErrUploadOffset for a stale offset, got %v", err)
+	}
+	u = NewUploads(s, filepath.Join(dir, "partial"))
+	got, err := u.Get(upload.ID)
+	if err != nil || got.Offset != 5 || got.Filename != "talk.mp4" {
+		t.Fatalf("Unexpected upload after reopen: %+v, %v", got, err)
+	}
+
+	// Bytes past the declared length are ignored
+	upload, err = u.Append(upload.ID, 5, strings.NewReader(" world and more"))
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if !upload.Complete() || upload.Offset != 11 {
+		t.Errorf("Expected a complete upload, got %+v", upload)
+	}
+
+	dest := filepath.Join(dir, "talk.mp4")
+	if err := u.Finish(upload.ID, dest); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil || string(data) != "hello world" {
+		t.Errorf("Unexpected assembled file %q, %v", data, err)
+	}
+	if _, err := u.Get(upload.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("Expected a finished upload to be forgotten, got %v", err)
+	}
+}
+
+func TestUploadsFinishIncomplete(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, filepath.Join(dir, "test.db"))
+	defer s.Close()
+	u := NewUploads(s, filepath.Join(dir, "partial"))
+
+	upload, err := u.Create("talk.mp4", 10)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := u.Finish(upload.ID, filepath.Join(dir, "talk.mp4")); err == nil {
+		t.Error("Expected an error finishing an incomplete upload")
+	}
+}
+
+func TestUploadsExpire(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, filepath.Join(dir, "test.db"))
+	defer s.Close()
+	u := NewUploads(s, filepath.Join(dir, "partial"))
+
+	stale, err := u.Create("old.mp4", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.UpdatedAt = time.Now().Add(-2 * time.Hour)
+	if err := s.putUpload(stale); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := u.Create("new.mp4", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := u.Expire(time.Hour)
+	if err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 expired upload, got %d", n)
+	}
+	if _, err := u.Get(stale.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("Expected the stale upload to be gone, got %v", err)
+	}
+	if _, err := os.Stat(u.partPath(stale.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale partial file to be removed, got %v", err)
+	}
+	if _, err := u.Get(fresh.ID); err != nil {
+		t.Errorf("Expected the fresh upload to be kept, got %v", err)
+	}
+}
+
+func TestUploadsDeleteWhileReceiving(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, filepath.Join(dir, "test.db"))
+	defer s.Close()
+	u := NewUploads(s, filepath.Join(dir, "partial"))
+
+	upload, err := u.Create("talk.mp4", 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The chunk's body arrives slowly, holding Append open
+	pr, pw := io.Pipe()
+	appended := make(chan error)
+	go func() {
+		_, err := u.Append(upload.ID, 0, pr)
+		appended <- err
+	}()
+	if _, err := pw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u.Delete(upload.ID); !errors.Is(err, ErrUploadBusy) {
+		t.Errorf("Expected a delete during a chunk to be refused, got %v", err)
+	}
+	pw.Close()
+	if err := <-appended; err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	if err := u.Delete(upload.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := u.Get(upload.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("Expected the upload to be gone, got %v", err)
+	}
+	if _, err := os.Stat(u.partPath(upload.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// VADOptions tune DetectSpeech. Zero values pick the defaults.
+type VADOptions struct {
+	// Frame is the analysis window. Default 30ms.
+	Frame time.Duration
+	// MinSilence is the shortest pause that splits speech. Default 600ms.
+	MinSilence time.Duration
+	// MinSpeech drops detected speech shorter than this, e.g. clicks.
+	// Default 250ms.
+	MinSpeech time.Duration
+	// Padding is kept around each speech region so word edges aren't
+	// clipped. Default 200ms.
+	Padding time.Duration
+	// AboveFloorDB is how far above the noise floor a frame must be to
+	// count as speech. Default 12 dB.
+	AboveFloorDB float64
+	// KeepMusic keeps loud stretches that sound like music rather than
+	// speech.
+	KeepMusic bool
+}
+
+func (o VADOptions) withDefaults() VADOptions {
+	if o.Frame <= 0 {
+		o.Frame = 30 * time.Millisecond
+	}
+	if o.MinSilence <= 0 {
+		o.MinSilence = 600 * time.Millisecond
+	}
+	if o.MinSpeech <= 0 {
+		o.MinSpeech = 250 * time.Millisecond
+	}
+	if o.Padding <= 0 {
+		o.Padding = 200 * time.Millisecond
+	}
+	if o.AboveFloorDB <= 0 {
+		o.AboveFloorDB = 12
+	}
+	return o
+}
+
+// Region is a stretch of the original audio.
+type Region struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ErrNoSpeech is returned by RemoveSilence when the audio has no speech.
+var ErrNoSpeech = errors.New("no speech detected")
+
+// silenceFloorDB is the level below which audio is treated as silent, even
+// in a recording with no noise floor at all.
+const silenceFloorDB = -50.0
+
+// wavFile is the layout of a 16-bit PCM WAV file.
+type wavFile struct {
+	sampleRate int
+	channels   int
+	dataOffset int64
+	dataSize   int64
+}
+
+func (w *wavFile) frameBytes() int64 {
+	return int64(2 * w.channels)
+}
+
+func (w *wavFile) duration() time.Duration {
+	frames := w.dataSize / w.frameBytes()
+	return time.Duration(frames) * time.Second / time.Duration(w.sampleRate)
+}
+
+// offset is the byte position of time t in the data chunk, relative to its
+// start.
+func (w *wavFile) offset(t time.Duration) int64 {
+	frames := int64(t) * int64(w.sampleRate) / int64(time.Second)
+	return min(frames*w.frameBytes(), w.dataSize)
+}
+
+// readWAVHeader parses the RIFF chunks up to the audio data. Only 16-bit
+// PCM is supported, which is what ProfileWAV produces.
+func readWAVHeader(f *os.File) (*wavFile, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(f, riff[:]); err != nil {
+		return nil, fmt.Errorf("not a WAV file: %v", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wavFile{}
+	pos := int64(12)
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(f, header[:]); err != nil {
+			return nil, errors.New("WAV file has no data chunk")
+		}
+		pos += 8
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		switch id {
+		case "fmt ":
+			fmtChunk := make([]byte, size)
+			if _, err := io.ReadFull(f, fmtChunk); err != nil || size < 16 {
+				return nil, errors.New("invalid WAV fmt chunk")
+			}
+			format := binary.LittleEndian.Uint16(fmtChunk[0:2])
+			w.channels = int(binary.LittleEndian.Uint16(fmtChunk[2:4]))
+			w.sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+			bits := binary.LittleEndian.Uint16(fmtChunk[14:16])
+			// 0xFFFE is WAVE_FORMAT_EXTENSIBLE, which ffmpeg uses for more
+			// than two channels
+			if (format != 1 && format != 0xFFFE) || bits != 16 || w.channels < 1 || w.sampleRate < 1 {
+				return nil, fmt.Errorf("unsupported WAV format %d with %d bits, need 16-bit PCM", format, bits)
+			}
+		case "data":
+			if w.sampleRate == 0 {
+				return nil, errors.New("WAV data before fmt chunk")
+			}
+			w.dataOffset = pos
+			// Streamed WAVs carry a placeholder size
+			w.dataSize = min(size, info.Size()-pos)
+			w.dataSize -= w.dataSize % w.frameBytes()
+			return w, nil
+		default:
+			if _, err := f.Seek(size, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+		// Chunks are padded to an even size
+		pos += size + size%2
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DetectSpeech finds the stretches of a 16-bit PCM WAV file loud enough to
+// be speech. Each frame's energy is compared with the recording's noise
+// floor, so quiet rooms and noisy field recordings both work. Music is then
+// told apart by how steady it is; see dropMusic.
+func DetectSpeech(wavPath string, opts VADOptions) ([]Region, time.Duration, error) {
+	opts = opts.withDefaults()
+	f, err := os.Open(wavPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	w, err := readWAVHeader(f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	levels, err := frameLevels(f, w, opts.Frame)
+	if err != nil {
+		return nil, 0, err
+	}
+	duration := w.duration()
+	if len(levels) == 0 {
+		return nil, duration, nil
+	}
+
+	// The quietest tenth of the recording is taken as its noise floor
+	sorted := append([]float64(nil), levels...)
+	sort.Float64s(sorted)
+	threshold := max(sorted[len(sorted)/10]+opts.AboveFloorDB, silenceFloorDB)
+
+	loud := make([]bool, len(levels))
+	for i, level := range levels {
+		loud[i] = level >= threshold
+	}
+	if !opts.KeepMusic {
+		dropMusic(levels, loud, opts.Frame)
+	}
+
+	var regions []Region
+	for i := range levels {
+		if !loud[i] {
+			continue
+		}
+		start := time.Duration(i) * opts.Frame
+		end := min(start+opts.Frame, duration)
+		if n := len(regions); n > 0 && start-regions[n-1].End < opts.MinSilence {
+			regions[n-1].End = end
+			continue
+		}
+		regions = append(regions, Region{Start: start, End: end})
+	}
+
+	var speech []Region
+	for _, r := range regions {
+		if r.End-r.Start < opts.MinSpeech {
+			continue
+		}
+		r.Start = max(r.Start-opts.Padding, 0)
+		r.End = min(r.End+opts.Padding, duration)
+		// Padding can close a gap
+		if n := len(speech); n > 0 && r.Start <= speech[n-1].End {
+			speech[n-1].End = r.End
+			continue
+		}
+		speech = append(speech, r)
+	}
+	return speech, duration, nil
+}
+
+// lowEnergyRatio is the share of frames in a second of speech that are
+// quieter than half its average energy: the gaps between syllables and
+// words. Music is more sustained and rarely has that many.
+const lowEnergyRatio = 0.15
+
+// dropMusic clears loud for each second of audio that is too steady to be
+// speech.
+func dropMusic(levels []float64, loud []bool, frame time.Duration) {
+	window := max(int(time.Second/frame), 1)
+	for start := 0; start < len(levels); start += window {
+		end := min(start+window, len(levels))
+		// A short tail can't be judged
+		if end-start < window/2 {
+			break
+		}
+		var mean float64
+		energies := make([]float64, end-start)
+		for i := range energies {
+			energies[i] = math.Pow(10, levels[start+i]/10)
+			mean += energies[i]
+		}
+		mean /= float64(len(energies))
+		low := 0
+		for _, e := range energies {
+			if e < mean/2 {
+				low++
+			}
+		}
+		if float64(low) < lowEnergyRatio*float64(len(energies)) {
+			clear(loud[start:end])
+		}
+	}
+}
+
+// frameLevels returns the RMS level in dBFS of each frame of the audio data,
+// averaging the channels.
+func frameLevels(f *os.File, w *wavFile, frame time.Duration) ([]float64, error) {
+	if _, err := f.Seek(w.dataOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	samplesPerFrame := int(int64(w.sampleRate) * int64(frame) / int64(time.Second))
+	if samplesPerFrame < 1 {
+		samplesPerFrame = 1
+	}
+	r := bufio.NewReaderSize(io.LimitReader(f, w.dataSize), 64*1024)
+	buf := make([]byte, samplesPerFrame*int(w.frameBytes()))
+
+	var levels []float64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			var sum float64
+			count := n / 2
+			for i := 0; i+1 < n; i += 2 {
+				s := float64(int16(binary.LittleEndian.Uint16(buf[i:]))) / 32768
+				sum += s * s
+			}
+			rms := math.Sqrt(sum / float64(count))
+			levels = append(levels, 20*math.Log10(rms+1e-10))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return levels, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SpeechMap maps times in condensed audio, made by RemoveSilence, back to
+// the original recording.
+type SpeechMap []speechPart
+
+type speechPart struct {
+	// At is where the region starts in the condensed audio.
+	At time.Duration
+	Region
+}
+
+// Original converts a time in the condensed audio to the original timeline.
+// Times in the gaps between regions snap to the end of the previous region.
+func (m SpeechMap) Original(t time.Duration) time.Duration {
+	if len(m) == 0 {
+		return t
+	}
+	i := sort.Search(len(m), func(i int) bool { return m[i].At > t }) - 1
+	if i < 0 {
+		return m[0].Start
+	}
+	return min(m[i].Start+t-m[i].At, m[i].End)
+}
+
+// originalStart is Original for the start of a segment: times in a gap snap
+// forward to the next region instead, so a segment never opens over the
+// silence that was cut.
+func (m SpeechMap) originalStart(t time.Duration) time.Duration {
+	i := sort.Search(len(m), func(i int) bool { return m[i].At > t })
+	if i > 0 && t-m[i-1].At >= m[i-1].End-m[i-1].Start && i < len(m) {
+		return m[i].Start
+	}
+	return m.Original(t)
+}
+
+// Apply moves every segment and word of the transcript back onto the
+// original timeline.
+func (m SpeechMap) Apply(t *Transcript) {
+	for i := range t.Segments {
+		seg := &t.Segments[i]
+		seg.Start, seg.End = m.originalStart(seg.Start), m.Original(seg.End)
+		seg.End = max(seg.End, seg.Start)
+		for j := range seg.Words {
+			w := &seg.Words[j]
+			w.Start, w.End = m.originalStart(w.Start), m.Original(w.End)
+			w.End = max(w.End, w.Start)
+		}
+	}
+}
+
+// speechGap is the silence left between regions in condensed audio, so
+// whisper still hears a pause between them.
+const speechGap = 500 * time.Millisecond
+
+// RemoveSilence writes the speech regions of a 16-bit PCM WAV file to a new
+// WAV at outPath, separated by short gaps, and returns the map back to the
+// original timeline. It returns ErrNoSpeech if there is nothing to keep.
+func RemoveSilence(wavPath, outPath string, opts VADOptions) (SpeechMap, error) {
+	regions, _, err := DetectSpeech(wavPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(regions) == 0 {
+		return nil, ErrNoSpeech
+	}
+
+	in, err := os.Open(wavPath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	w, err := readWAVHeader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out the layout first; the header needs the data size
+	gapBytes := w.offset(speechGap)
+	var m SpeechMap
+	var dataSize int64
+	for i, r := range regions {
+		if i > 0 {
+			dataSize += gapBytes
+		}
+		at := time.Duration(dataSize/w.frameBytes()) * time.Second / time.Duration(w.sampleRate)
+		m = append(m, speechPart{At: at, Region: r})
+		dataSize += w.offset(r.End) - w.offset(r.Start)
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(out)
+	err = writeWAVHeader(bw, w, dataSize)
+	for i, r := range regions {
+		if err != nil {
+			break
+		}
+		if i > 0 {
+			_, err = bw.Write(make([]byte, gapBytes))
+			if err != nil {
+				break
+			}
+		}
+		start, end := w.offset(r.Start), w.offset(r.End)
+		_, err = io.Copy(bw, io.NewSectionReader(in, w.dataOffset+start, end-start))
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return nil, fmt.Errorf("failed to write speech audio: %v", err)
+	}
+	return m, nil
+}
+
+func writeWAVHeader(wr io.Writer, w *wavFile, dataSize int64) error {
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+dataSize))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], uint16(w.channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(int64(w.sampleRate)*w.frameBytes()))
+	binary.LittleEndian.PutUint16(header[32:], uint16(w.frameBytes()))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+	_, err := wr.Write(header)
+	return err
+}
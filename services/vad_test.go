@@ -0,0 +1,233 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// toneSpan is a stretch of test audio: a 440 Hz tone at amplitude (0 to 1),
+// or silence at 0. The tone pulses four times a second like syllables unless
+// it is sustained like music.
+type toneSpan struct {
+	length    time.Duration
+	amplitude float64
+	sustained bool
+}
+
+// writeTestWAV writes 16 kHz mono PCM made of spans.
+func writeTestWAV(t *testing.T, spans ...toneSpan) string {
+	t.Helper()
+	const rate = 16000
+	var data bytes.Buffer
+	n := 0
+	for _, s := range spans {
+		for i := 0; i < int(s.length.Seconds()*rate); i++ {
+			v := s.amplitude * math.Sin(2*math.Pi*440*float64(n)/rate)
+			if !s.sustained {
+				v *= math.Abs(math.Sin(2 * math.Pi * 2 * float64(n) / rate))
+			}
+			binary.Write(&data, binary.LittleEndian, int16(v*32767))
+			n++
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeWAVHeader(&buf, &wavFile{sampleRate: rate, channels: 1}, int64(data.Len())); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(data.Bytes())
+	path := filepath.Join(t.TempDir(), "audio.wav")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// near allows for regions snapping to 30ms analysis frames at either edge.
+func near(a, b time.Duration) bool {
+	d := a - b
+	return d > -60*time.Millisecond && d < 60*time.Millisecond
+}
+
+func TestDetectSpeech(t *testing.T) {
+	path := writeTestWAV(t,
+		toneSpan{1 * time.Second, 0, false},
+		toneSpan{2 * time.Second, 0.5, false},
+		// Short pauses are part of the speech
+		toneSpan{300 * time.Millisecond, 0, false},
+		toneSpan{700 * time.Millisecond, 0.5, false},
+		toneSpan{3 * time.Second, 0, false},
+		// A click is too short to be speech
+		toneSpan{60 * time.Millisecond, 0.8, false},
+		toneSpan{2 * time.Second, 0, false},
+		toneSpan{1 * time.Second, 0.3, false},
+		toneSpan{1 * time.Second, 0, false},
+	)
+
+	regions, duration, err := DetectSpeech(path, VADOptions{})
+	if err != nil {
+		t.Fatalf("DetectSpeech failed: %v", err)
+	}
+	if !near(duration, 11060*time.Millisecond) {
+		t.Errorf("Expected duration 11.06s, got %v", duration)
+	}
+	// Each region is padded by 200ms
+	want := []Region{
+		{Start: 800 * time.Millisecond, End: 4200 * time.Millisecond},
+		{Start: 8860 * time.Millisecond, End: 10260 * time.Millisecond},
+	}
+	if len(regions) != len(want) {
+		t.Fatalf("Expected %d regions, got %v", len(want), regions)
+	}
+	for i, r := range regions {
+		if !near(r.Start, want[i].Start) || !near(r.End, want[i].End) {
+			t.Errorf("Region %d: expected %v, got %v", i, want[i], r)
+		}
+	}
+}
+
+func TestDetectSpeechNoiseFloor(t *testing.T) {
+	// A constant hum is the floor; only what stands out above it is speech
+	path := writeTestWAV(t,
+		toneSpan{2 * time.Second, 0.05, true},
+		toneSpan{1 * time.Second, 0.5, false},
+		toneSpan{2 * time.Second, 0.05, true},
+	)
+	regions, _, err := DetectSpeech(path, VADOptions{})
+	if err != nil {
+		t.Fatalf("DetectSpeech failed: %v", err)
+	}
+	if len(regions) != 1 || !near(regions[0].Start, 1800*time.Millisecond) || !near(regions[0].End, 3200*time.Millisecond) {
+		t.Errorf("Expected one region around 1.8s-3.2s, got %v", regions)
+	}
+}
+
+func TestDetectSpeechMusic(t *testing.T) {
+	path := writeTestWAV(t,
+		toneSpan{1 * time.Second, 0, false},
+		toneSpan{3 * time.Second, 0.5, true},
+		toneSpan{2 * time.Second, 0.5, false},
+		toneSpan{1 * time.Second, 0, false},
+	)
+	regions, _, err := DetectSpeech(path, VADOptions{})
+	if err != nil {
+		t.Fatalf("DetectSpeech failed: %v", err)
+	}
+	if len(regions) != 1 || !near(regions[0].Start, 3800*time.Millisecond) || !near(regions[0].End, 6200*time.Millisecond) {
+		t.Errorf("Expected only the speech around 3.8s-6.2s, got %v", regions)
+	}
+
+	regions, _, err = DetectSpeech(path, VADOptions{KeepMusic: true})
+	if err != nil {
+		t.Fatalf("DetectSpeech failed: %v", err)
+	}
+	if len(regions) != 1 || !near(regions[0].Start, 800*time.Millisecond) {
+		t.Errorf("Expected the music kept from 0.8s, got %v", regions)
+	}
+}
+
+func TestDetectSpeechNotWAV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audio.ogg")
+	if err := os.WriteFile(path, []byte("OggS not a wav file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DetectSpeech(path, VADOptions{}); err == nil {
+		t.Error("Expected an error for a non-WAV file")
+	}
+}
+
+func TestRemoveSilence(t *testing.T) {
+	path := writeTestWAV(t,
+		toneSpan{5 * time.Second, 0, false},
+		toneSpan{1 * time.Second, 0.5, false},
+		toneSpan{20 * time.Second, 0, false},
+		toneSpan{2 * time.Second, 0.5, false},
+		toneSpan{5 * time.Second, 0, false},
+	)
+	out := filepath.Join(t.TempDir(), "speech.wav")
+	speech, err := RemoveSilence(path, out, VADOptions{})
+	if err != nil {
+		t.Fatalf("RemoveSilence failed: %v", err)
+	}
+
+	// 1.4s and 2.4s of padded speech with a gap between, give or take a
+	// frame at each edge
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := readWAVHeader(f)
+	if err != nil {
+		t.Fatalf("Output is not a valid WAV: %v", err)
+	}
+	want := 1400*time.Millisecond + speechGap + 2400*time.Millisecond
+	if d := w.duration() - want; d < -120*time.Millisecond || d > 120*time.Millisecond {
+		t.Errorf("Expected %v of speech audio, got %v", want, w.duration())
+	}
+
+	tests := []struct {
+		condensed time.Duration
+		want      time.Duration
+	}{
+		{0, 4800 * time.Millisecond},
+		{1 * time.Second, 5800 * time.Millisecond},
+		// In the gap
+		{1600 * time.Millisecond, 6200 * time.Millisecond},
+		{1900*time.Millisecond + 500*time.Millisecond, 26300 * time.Millisecond},
+		// Past the end
+		{time.Minute, 28200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := speech.Original(tt.condensed); !near(got, tt.want) {
+			t.Errorf("Original(%v): expected %v, got %v", tt.condensed, tt.want, got)
+		}
+	}
+}
+
+func TestRemoveSilenceNoSpeech(t *testing.T) {
+	path := writeTestWAV(t, toneSpan{3 * time.Second, 0, false})
+	out := filepath.Join(t.TempDir(), "speech.wav")
+	if _, err := RemoveSilence(path, out, VADOptions{}); !errors.Is(err, ErrNoSpeech) {
+		t.Errorf("Expected ErrNoSpeech, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("Expected no output file")
+	}
+}
+
+func TestSpeechMapApply(t *testing.T) {
+	speech := SpeechMap{
+		{At: 0, Region: Region{Start: 10 * time.Second, End: 12 * time.Second}},
+		{At: 3 * time.Second, Region: Region{Start: 60 * time.Second, End: 65 * time.Second}},
+	}
+	transcript := &Transcript{Segments: []Segment{
+		{Start: 500 * time.Millisecond, End: 2 * time.Second, Text: "first"},
+		// Starts in the gap: opens with the next region, not over the
+		// removed silence
+		{Start: 2500 * time.Millisecond, End: 4 * time.Second, Text: "second"},
+	}}
+	speech.Apply(transcript)
+
+	want := []Segment{
+		{Start: 10500 * time.Millisecond, End: 12 * time.Second, Text: "first"},
+		{Start: 60 * time.Second, End: 61 * time.Second, Text: "second"},
+	}
+	for i, seg := range transcript.Segments {
+		if !reflect.DeepEqual(seg, want[i]) {
+			t.Errorf("Segment %d: expected %+v, got %+v", i, want[i], seg)
+		}
+	}
+
+	// Without silence removed, times are unchanged
+	var none SpeechMap
+	if got := none.Original(5 * time.Second); got != 5*time.Second {
+		t.Errorf("Expected an empty map to keep times, got %v", got)
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// VTTOptions controls the optional parts of a WebVTT file.
+type VTTOptions struct {
+	// Notes are written as NOTE comment blocks after the header.
+	Notes []string
+	// CueSettings are appended to every cue timing line,
+	// e.g. "line:90% align:center".
+	CueSettings string
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// WriteVTT writes the segments to w as a WebVTT (.vtt) file.
+func WriteVTT(w io.Writer, segments []Segment, opts VTTOptions) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+
+	for _, note := range opts.Notes {
+		note = collapseBlankLines(strings.TrimSpace(note))
+		if note == "" {
+			continue
+		}
+		// A NOTE block must not contain the cue timing arrow
+		note = strings.ReplaceAll(note, "-->", "->")
+		fmt.Fprintf(bw, "NOTE %s\n\n", note)
+	}
+
+	settings := strings.TrimSpace(opts.CueSettings)
+	if settings != "" {
+		settings = " " + settings
+	}
+
+	for _, seg := range segments {
+		text := strings.TrimSpace(seg.Text)
+		if text == "" {
+			continue
+		}
+		// Escaping also turns any "-->" in the text into "--&gt;"
+		text = vttEscaper.Replace(collapseBlankLines(text))
+		fmt.Fprintf(bw, "%s --> %s%s\n%s\n\n",
+			FormatTimestamp(seg.Start, "."), FormatTimestamp(seg.End, "."), settings, text)
+	}
+	return bw.Flush()
+}
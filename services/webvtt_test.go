@@ -0,0 +1,47 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteVTT(t *testing.T) {
+	segments := []Segment{
+		{Start: 0, End: 1500 * time.Millisecond, Text: "Tom & Jerry <3"},
+		{Start: 1500 * time.Millisecond, End: 2 * time.Second, Text: ""},
+		{Start: time.Hour, End: time.Hour + time.Second, Text: "a --> b\n\nc"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteVTT(&buf, segments, VTTOptions{}); err != nil {
+		t.Fatalf("WriteVTT failed: %v", err)
+	}
+
+	expected := "WEBVTT\n\n" +
+		"00:00:00.000 --> 00:00:01.500\nTom &amp; Jerry &lt;3\n\n" +
+		"01:00:00.000 --> 01:00:01.000\na --&gt; b\nc\n\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected VTT output:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteVTTNotesAndSettings(t *testing.T) {
+	segments := []Segment{{Start: 0, End: time.Second, Text: "Hi"}}
+	opts := VTTOptions{
+		Notes:       []string{"Generated --> automatically", "  "},
+		CueSettings: " line:90% align:center ",
+	}
+
+	var buf bytes.Buffer
+	if err := WriteVTT(&buf, segments, opts); err != nil {
+		t.Fatalf("WriteVTT failed: %v", err)
+	}
+
+	expected := "WEBVTT\n\n" +
+		"NOTE Generated -> automatically\n\n" +
+		"00:00:00.000 --> 00:00:01.000 line:90% align:center\nHi\n\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected VTT output:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WhisperCpp is the Transcriber backed by whisper.cpp, either its CLI or a
+// running whisper.cpp server. It is much faster than the Python whisper on
+// machines without a GPU.
+type WhisperCpp struct {
+	// Binary is the CLI: whisper-cli in current releases, main in older
+	// ones. Empty looks for whisper-cli, then whisper-cpp, in PATH.
+	Binary string
+	// ModelDir holds ggml models named ggml-<model>.bin, as whisper.cpp's
+	// download script saves them.
+	ModelDir string
+	// Models are the models in ModelDir jobs can pick; the first is the
+	// default. See WhisperCppModels.
+	Models []string
+	// Threads is how many CPU threads the CLI uses. Zero leaves whisper.cpp's
+	// default of up to four.
+	Threads int
+	// ServerURL, if set, sends audio to a whisper.cpp server, e.g.
+	// http://localhost:8080, instead of running the CLI. The server has a
+	// single model, chosen when it was started.
+	ServerURL string
+	// Client sends the server requests. The server gets the whole file at
+	// once, which on a CPU can take longer than any sensible timeout, so
+	// the client should not retry timeouts. Nil means NewWhisperCppClient(0).
+	Client *APIClient
+}
+
+func (WhisperCpp) Name() string { return "whispercpp" }
+
+func (w WhisperCpp) Description() string {
+	if w.ServerURL != "" {
+		return "whisper.cpp server"
+	}
+	return "whisper.cpp"
+}
+
+func (w WhisperCpp) Capabilities() Capabilities {
+	caps := Capabilities{Timestamps: true, Audio: ProfileWAV}
+	if w.ServerURL == "" {
+		caps.Models = w.Models
+	}
+	return caps
+}
+
+func (w WhisperCpp) Transcribe(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if w.ServerURL != "" {
+		return w.transcribeServer(ctx, audioPath, opts)
+	}
+	return w.transcribeCLI(ctx, audioPath, opts)
+}
+
+// WhisperCppModels lists the models in dir, sorted from smallest to largest
+// by file size, so the first is a quick default.
+func WhisperCppModels(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "ggml-*.bin"))
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64)
+	var models []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "ggml-"), ".bin")
+		sizes[name] = info.Size()
+		models = append(models, name)
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("no ggml-*.bin models in %s", dir)
+	}
+	sort.Slice(models, func(i, j int) bool { return sizes[models[i]] < sizes[models[j]] })
+	return models, nil
+}
+
+func (w WhisperCpp) binary() (string, error) {
+	if w.Binary != "" {
+		return w.Binary, nil
+	}
+	for _, name := range []string{"whisper-cli", "whisper-cpp"} {
+		if path, err := execLookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("whisper.cpp CLI not found in PATH, set its path in WHISPER_CPP_BIN")
+}
+
+// CheckTool reports the CLI's path, or the server's URL. whisper.cpp has no
+// version flag.
+func (w WhisperCpp) CheckTool() ToolCheck {
+	check := ToolCheck{Name: "whisper.cpp"}
+	if w.ServerURL != "" {
+		check.Path = w.ServerURL
+		return check
+	}
+	check.Path, check.Err = w.binary()
+	return check
+}
+
+// whisperCppProgressRe matches the lines -pp prints, e.g.
+// "whisper_print_progress_callback: progress =  40%".
+var whisperCppProgressRe = regexp.MustCompile(`progress =\s*(\d+)%`)
+
+func (w WhisperCpp) transcribeCLI(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	binary, err := w.binary()
+	if err != nil {
+		return nil, err
+	}
+	model := opts.Model
+	if model == "" && len(w.Models) > 0 {
+		model = w.Models[0]
+	}
+	if model == "" {
+		return nil, errors.New("no whisper.cpp model configured")
+	}
+	modelPath := filepath.Join(w.ModelDir, "ggml-"+model+".bin")
+
+	tempDir, err := os.MkdirTemp("", "whispercpp_output")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	outBase := filepath.Join(tempDir, "transcript")
+
+	// whisper-cli -m <model> -f <audio> -oj -of <out> -pp -l <lang> [-t N] [--prompt ..] [-tp T]
+	// whisper.cpp assumes English unless told otherwise, so auto is explicit
+	language := opts.Language
+	if language == "" {
+		language = "auto"
+	}
+	args := []string{"-m", modelPath, "-f", audioPath, "-oj", "-of", outBase, "-pp", "-l", language}
+	if w.Threads > 0 {
+		args = append(args, "-t", strconv.Itoa(w.Threads))
+	}
+	if opts.Prompt != "" {
+		args = append(args, "--prompt", opts.Prompt)
+	}
+	if opts.Temperature > 0 {
+		args = append(args, "-tp", strconv.FormatFloat(opts.Temperature, 'f', -1, 64))
+	}
+	if opts.BeamSize > 0 {
+		args = append(args, "-bs", strconv.Itoa(opts.BeamSize))
+	}
+	cmd := execCommand(binary, args...)
+
+	// Progress is printed as a percentage, so it needs the audio's length
+	var onLine func(string)
+	if opts.Progress != nil {
+		if duration, err := wavDuration(audioPath); err == nil {
+			onLine = func(line string) {
+				if m := whisperCppProgressRe.FindStringSubmatch(line); m != nil {
+					pct, _ := strconv.Atoi(m[1])
+					opts.Progress(duration * time.Duration(pct) / 100)
+				}
+			}
+		}
+	}
+
+	output, err := runCommand(ctx, cmd, onLine)
+	if err != nil {
+		return nil, fmt.Errorf("whisper.cpp failed: %v\nOutput: %s", err, string(output))
+	}
+
+	file, err := os.Open(outBase + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript file: %v", err)
+	}
+	defer file.Close()
+	transcript, err := parseWhisperCppJSON(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse transcript file: %v", err)
+	}
+	return transcript, nil
+}
+
+// whisperCppResult is the JSON whisper.cpp writes with -oj.
+type whisperCppResult struct {
+	Result struct {
+		Language string `json:"language"`
+	} `json:"result"`
+	Transcription []struct {
+		// Offsets are in milliseconds
+		Offsets struct {
+			From int64 `json:"from"`
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text string `json:"text"`
+	} `json:"transcription"`
+}
+
+func parseWhisperCppJSON(r io.Reader) (*Transcript, error) {
+	var result whisperCppResult
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, err
+	}
+	t := &Transcript{Language: result.Result.Language}
+	for _, seg := range result.Transcription {
+		t.Segments = append(t.Segments, Segment{
+			Start: time.Duration(seg.Offsets.From) * time.Millisecond,
+			End:   time.Duration(seg.Offsets.To) * time.Millisecond,
+			Text:  strings.TrimSpace(seg.Text),
+		})
+	}
+	return t, nil
+}
+
+// NewWhisperCppClient returns a client for a whisper.cpp server that gives
+// each request timeout, or no limit but the job's for zero, and never
+// retries a request that timed out.
+func NewWhisperCppClient(timeout time.Duration) *APIClient {
+	c := NewAPIClient(timeout)
+	c.RetryTimeouts = false
+	return c
+}
+
+var defaultWhisperCppClient = NewWhisperCppClient(0)
+
+// transcribeServer posts the audio to the server's /inference endpoint and
+// asks for SRT, which every version of the server can send.
+func (w WhisperCpp) transcribeServer(ctx context.Context, audioPath string, opts TranscribeOptions) (*Transcript, error) {
+	client := w.Client
+	if client == nil {
+		client = defaultWhisperCppClient
+	}
+	url := strings.TrimSuffix(w.ServerURL, "/") + "/inference"
+
+	resp, err := client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		file, err := os.Open(audioPath)
+		if err != nil {
+			return nil, err
+		}
+		pr, pw := io.Pipe()
+		writer := multipart.NewWriter(pw)
+		go func() {
+			defer file.Close()
+			pw.CloseWithError(writeWhisperCppForm(writer, file, filepath.Base(audioPath), opts))
+		}()
+		req, err := http.NewRequestWithContext(ctx, "POST", url, pr)
+		if err != nil {
+			pr.CloseWithError(err)
+			return nil, err
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	segments, err := ParseSRT(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse whisper.cpp server response: %v", err)
+	}
+	// The server keeps the space whisper puts before each segment
+	for i := range segments {
+		segments[i].Text = strings.TrimSpace(segments[i].Text)
+	}
+	return &Transcript{Segments: segments}, nil
+}
+
+func writeWhisperCppForm(writer *multipart.Writer, audio io.Reader, filename string, opts TranscribeOptions) error {
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, audio); err != nil {
+		return err
+	}
+	_ = writer.WriteField("response_format", "srt")
+	language := opts.Language
+	if language == "" {
+		language = "auto"
+	}
+	_ = writer.WriteField("language", language)
+	if opts.Prompt != "" {
+		_ = writer.WriteField("prompt", opts.Prompt)
+	}
+	if opts.Temperature > 0 {
+		_ = writer.WriteField("temperature", strconv.FormatFloat(opts.Temperature, 'f', -1, 64))
+	}
+	return writer.Close()
+}
+
+// wavDuration reads the length of a 16-bit PCM WAV file from its header.
+func wavDuration(path string) (time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w, err := readWAVHeader(f)
+	if err != nil {
+		return 0, err
+	}
+	return w.duration(), nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHelperProcessWhisperCpp(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+	// The arguments are echoed so the test can check them
+	fmt.Println(strings.Join(args, " "))
+
+	var outBase string
+	for i, arg := range args {
+		if arg == "-of" && i+1 < len(args) {
+			outBase = args[i+1]
+		}
+	}
+	if outBase == "" {
+		fmt.Fprintf(os.Stderr, "No -of\n")
+		os.Exit(2)
+	}
+	fmt.Fprintln(os.Stderr, "whisper_print_progress_callback: progress =  50%")
+	result := `{"result": {"language": "de"}, "transcription": [
+		{"timestamps": {"from": "00:00:00,000", "to": "00:00:01,500"}, "offsets": {"from": 0, "to": 1500}, "text": " Guten"},
+		{"timestamps": {"from": "00:00:01,500", "to": "00:00:02,000"}, "offsets": {"from": 1500, "to": 2000}, "text": " Tag"}
+	]}`
+	if err := os.WriteFile(outBase+".json", []byte(result), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output file: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, "whisper_print_progress_callback: progress = 100%")
+	os.Exit(0)
+}
+
+func mockWhisperCpp(t *testing.T, args *[]string) {
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		*args = append([]string{name}, arg...)
+		cs := []string{"-test.run=TestHelperProcessWhisperCpp", "--", name}
+		cs = append(cs, arg...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+	t.Cleanup(func() { execCommand = exec.Command })
+}
+
+func TestWhisperCppCLI(t *testing.T) {
+	var args []string
+	mockWhisperCpp(t, &args)
+	audio := writeTestWAV(t, toneSpan{2 * time.Second, 0.5, false})
+
+	w := WhisperCpp{Binary: "/opt/whisper.cpp/main", ModelDir: "/models", Models: []string{"base.en", "large-v3"}, Threads: 8}
+	var positions []time.Duration
+	transcript, err := w.Transcribe(context.Background(), audio, TranscribeOptions{
+		Model:    "large-v3",
+		Language: "de",
+		Progress: func(position time.Duration) { positions = append(positions, position) },
+	})
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+
+	want := []Segment{
+		{Start: 0, End: 1500 * time.Millisecond, Text: "Guten"},
+		{Start: 1500 * time.Millisecond, End: 2 * time.Second, Text: "Tag"},
+	}
+	if !reflect.DeepEqual(transcript.Segments, want) {
+		t.Errorf("Expected %+v, got %+v", want, transcript.Segments)
+	}
+	if transcript.Language != "de" {
+		t.Errorf("Expected language de, got %q", transcript.Language)
+	}
+
+	command := strings.Join(args, " ")
+	for _, want := range []string{"/opt/whisper.cpp/main ", "-m /models/ggml-large-v3.bin", "-t 8", "-l de", "-f " + audio} {
+		if !strings.Contains(command, want) {
+			t.Errorf("Expected %q in %q", want, command)
+		}
+	}
+	if !reflect.DeepEqual(positions, []time.Duration{time.Second, 2 * time.Second}) {
+		t.Errorf("Expected progress [1s 2s], got %v", positions)
+	}
+}
+
+func TestWhisperCppCLIDefaults(t *testing.T) {
+	var args []string
+	mockWhisperCpp(t, &args)
+	execLookPath = func(file string) (string, error) {
+		if file == "whisper-cli" {
+			return "/usr/local/bin/whisper-cli", nil
+		}
+		return "", exec.ErrNotFound
+	}
+	defer func() { execLookPath = exec.LookPath }()
+	audio := writeTestWAV(t, toneSpan{time.Second, 0.5, false})
+
+	w := WhisperCpp{ModelDir: "/models", Models: []string{"base.en"}}
+	if _, err := w.Transcribe(context.Background(), audio, TranscribeOptions{}); err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	command := strings.Join(args, " ")
+	// The first model is the default, and whisper.cpp must be told to detect the language
+	for _, want := range []string{"/usr/local/bin/whisper-cli ", "-m /models/ggml-base.en.bin", "-l auto"} {
+		if !strings.Contains(command, want) {
+			t.Errorf("Expected %q in %q", want, command)
+		}
+	}
+	if strings.Contains(command, " -t ") {
+		t.Errorf("Expected whisper.cpp's default thread count, got %q", command)
+	}
+}
+
+func TestWhisperCppServer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/inference" {
+			t.Errorf("Expected POST /inference, got %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.FormValue("response_format"); got != "srt" {
+			t.Errorf("Expected response_format srt, got %q", got)
+		}
+		if got := r.FormValue("language"); got != "auto" {
+			t.Errorf("Expected language auto, got %q", got)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Expected an audio file: %v", err)
+		} else {
+			data, _ := io.ReadAll(file)
+			if string(data) != "audio" {
+				t.Errorf("Expected the audio, got %q", data)
+			}
+		}
+		fmt.Fprint(w, "1\n00:00:00,000 --> 00:00:02,500\n Hello there\n\n")
+	}))
+	defer ts.Close()
+
+	audio := filepath.Join(t.TempDir(), "audio.wav")
+	if err := os.WriteFile(audio, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := WhisperCpp{ServerURL: ts.URL + "/"}
+	transcript, err := w.Transcribe(context.Background(), audio, TranscribeOptions{})
+	if err != nil {
+		t.Fatalf("Transcribe failed: %v", err)
+	}
+	want := []Segment{{Start: 0, End: 2500 * time.Millisecond, Text: "Hello there"}}
+	if !reflect.DeepEqual(transcript.Segments, want) {
+		t.Errorf("Expected %+v, got %+v", want, transcript.Segments)
+	}
+	// The server's model is fixed, so jobs can't pick one
+	if w.Capabilities().Models != nil {
+		t.Errorf("Expected no models for the server, got %v", w.Capabilities().Models)
+	}
+}
+
+func TestWhisperCppModels(t *testing.T) {
+	dir := t.TempDir()
+	for name, size := range map[string]int{"ggml-medium.bin": 30, "ggml-base.en.bin": 10, "ggml-small.bin": 20, "notes.txt": 1} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	models, err := WhisperCppModels(dir)
+	if err != nil {
+		t.Fatalf("WhisperCppModels failed: %v", err)
+	}
+	if want := []string{"base.en", "small", "medium"}; !reflect.DeepEqual(models, want) {
+		t.Errorf("Expected %v, got %v", want, models)
+	}
+	if _, err := WhisperCppModels(t.TempDir()); err == nil {
+		t.Error("Expected an error for a directory without models")
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// WhisperResult is the result the whisper CLI writes with
+// --output_format json, as returned by whisper's transcribe(). Times are in
+// seconds.
+type WhisperResult struct {
+	Text     string           `json:"text"`
+	Segments []WhisperSegment `json:"segments"`
+	// Language is the code whisper was given or detected, e.g. "en".
+	Language string `json:"language"`
+}
+
+// WhisperSegment is one decoded window of audio.
+type WhisperSegment struct {
+	ID int `json:"id"`
+	// Seek is the offset, in 10ms frames, of the 30-second window the
+	// segment was decoded from.
+	Seek   int     `json:"seek"`
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+	Text   string  `json:"text"`
+	Tokens []int   `json:"tokens"`
+	// Temperature is the sampling temperature whisper settled on; above 0
+	// means the greedy decode failed its quality checks and was retried.
+	Temperature float64 `json:"temperature"`
+	// AvgLogProb is the mean log probability of the tokens. Whisper treats
+	// below -1 as a failed decode.
+	AvgLogProb float64 `json:"avg_logprob"`
+	// CompressionRatio is the gzip ratio of the text. Above 2.4 means
+	// repetitive text, usually a hallucination loop.
+	CompressionRatio float64 `json:"compression_ratio"`
+	// NoSpeechProb is the probability the window has no speech at all.
+	NoSpeechProb float64 `json:"no_speech_prob"`
+	// Words are only present with --word_timestamps True.
+	Words []WhisperWord `json:"words,omitempty"`
+}
+
+// WhisperWord is a timed word, with its leading space.
+type WhisperWord struct {
+	Word        string  `json:"word"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Probability float64 `json:"probability"`
+}
+
+// ParseWhisperJSON decodes whisper's JSON result.
+func ParseWhisperJSON(r io.Reader) (*WhisperResult, error) {
+	var result WhisperResult
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Transcript converts the result to the shared model, keeping each
+// segment's confidence data.
+func (r *WhisperResult) Transcript() *Transcript {
+	t := &Transcript{Language: r.Language}
+	for _, seg := range r.Segments {
+		s := Segment{
+			Start: secondsToDuration(seg.Start),
+			End:   secondsToDuration(seg.End),
+			Text:  strings.TrimSpace(seg.Text),
+			Confidence: &Confidence{
+				AvgLogProb:       seg.AvgLogProb,
+				NoSpeechProb:     seg.NoSpeechProb,
+				CompressionRatio: seg.CompressionRatio,
+				Temperature:      seg.Temperature,
+			},
+		}
+		for _, w := range seg.Words {
+			s.Words = append(s.Words, Word{
+				Start:       secondsToDuration(w.Start),
+				End:         secondsToDuration(w.End),
+				Text:        strings.TrimSpace(w.Word),
+				Probability: w.Probability,
+			})
+		}
+		t.Segments = append(t.Segments, s)
+	}
+	return t
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// whisperFixture is trimmed from a real `whisper --output_format json
+// --word_timestamps True` run.
+const whisperFixture = `{
+  "text": " Welcome back. Uh, uh, uh, uh.",
+  "segments": [
+    {"id": 0, "seek": 0, "start": 0.0, "end": 1.84, "text": " Welcome back.",
+     "tokens": [50364, 14436, 646, 13, 50456], "temperature": 0.0,
+     "avg_logprob": -0.21, "compression_ratio": 0.89, "no_speech_prob": 0.012,
+     "words": [
+       {"word": " Welcome", "start": 0.0, "end": 0.62, "probability": 0.97},
+       {"word": " back.", "start": 0.62, "end": 1.84, "probability": 0.91}
+     ]},
+    {"id": 1, "seek": 184, "start": 1.84, "end": 30.0, "text": " Uh, uh, uh, uh.",
+     "tokens": [50456, 4019, 11, 2232, 50814], "temperature": 0.4,
+     "avg_logprob": -1.37, "compression_ratio": 2.71, "no_speech_prob": 0.74,
+     "words": []}
+  ],
+  "language": "en"
+}`
+
+func TestParseWhisperJSON(t *testing.T) {
+	result, err := ParseWhisperJSON(strings.NewReader(whisperFixture))
+	if err != nil {
+		t.Fatalf("ParseWhisperJSON failed: %v", err)
+	}
+	if result.Language != "en" || len(result.Segments) != 2 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	seg := result.Segments[1]
+	if seg.ID != 1 || seg.Seek != 184 || len(seg.Tokens) != 5 || seg.Temperature != 0.4 || seg.NoSpeechProb != 0.74 {
+		t.Errorf("Unexpected second segment: %+v", seg)
+	}
+
+	transcript := result.Transcript()
+	if transcript.Language != "en" {
+		t.Errorf("Expected language en, got %q", transcript.Language)
+	}
+	first := transcript.Segments[0]
+	if first.Text != "Welcome back." || first.End != 1840*time.Millisecond {
+		t.Errorf("Unexpected first segment: %+v", first)
+	}
+	if len(first.Words) != 2 || first.Words[1].Text != "back." || first.Words[1].Probability != 0.91 {
+		t.Errorf("Unexpected words: %+v", first.Words)
+	}
+	if c := first.Confidence; c == nil || c.AvgLogProb != -0.21 || c.Doubtful() {
+		t.Errorf("Expected a confident first segment, got %+v", c)
+	}
+	// The second is a typical hallucination over silence
+	if c := transcript.Segments[1].Confidence; !c.Doubtful() {
+		t.Errorf("Expected the second segment to be doubtful, got %+v", c)
+	}
+}
+
+func TestParseWhisperJSONInvalid(t *testing.T) {
+	if _, err := ParseWhisperJSON(strings.NewReader("1\n00:00:00,000 --> 00:00:01,000\nsrt\n")); err == nil {
+		t.Error("Expected an error for non-JSON output")
+	}
+}
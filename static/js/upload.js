@@ -0,0 +1,189 @@
+// Resumable video uploads over the tus protocol (see handlers/tus.go).
+// The file is sent in chunks; after a dropped connection the upload resumes
+// from the offset the server reports, and reloading the page and picking the
+// same file again continues where it stopped.
+(function () {
+    var CHUNK_SIZE = 8 * 1024 * 1024;
+    var RETRY_DELAYS = [1000, 3000, 5000, 10000, 30000];
+
+    function storageKey(file) {
+        return 'tus:' + file.name + ':' + file.size + ':' + file.lastModified;
+    }
+
+    // request sends one tus request and resolves with the XHR, whatever its
+    // status. Network failures reject.
+    function request(method, url, headers, body, onProgress) {
+        return new Promise(function (resolve, reject) {
+            var xhr = new XMLHttpRequest();
+            xhr.open(method, url);
+            xhr.setRequestHeader('Tus-Resumable', '1.0.0');
+            Object.keys(headers).forEach(function (name) {
+                xhr.setRequestHeader(name, headers[name]);
+            });
+            if (onProgress) {
+                xhr.upload.onprogress = function (evt) { onProgress(evt.loaded); };
+            }
+            xhr.onload = function () { resolve(xhr); };
+            xhr.onerror = function () { reject(new Error('Network error')); };
+            xhr.send(body);
+        });
+    }
+
+    function wait(ms) {
+        return new Promise(function (resolve) { setTimeout(resolve, ms); });
+    }
+
+    function fail(xhr) {
+        var err = new Error(xhr.responseText.trim() || ('Upload failed (' + xhr.status + ')'));
+        err.status = xhr.status;
+        return err;
+    }
+
+    // start returns the URL of the upload for file, resuming a previous one
+    // when the server still has it.
+    function start(file) {
+        var key = storageKey(file);
+        var url = localStorage.getItem(key);
+        if (url) {
+            return request('HEAD', url, {}, null).then(function (xhr) {
+                if (xhr.status === 200) {
+                    return url;
+                }
+                localStorage.removeItem(key);
+                return start(file);
+            });
+        }
+        var meta = 'filename ' + btoa(unescape(encodeURIComponent(file.name)));
+        return request('POST', '/uploads', { 'Upload-Length': String(file.size), 'Upload-Metadata': meta }, null)
+            .then(function (xhr) {
+                if (xhr.status !== 201) {
+                    throw fail(xhr);
+                }
+                url = xhr.getResponseHeader('Location');
+                localStorage.setItem(key, url);
+                return url;
+            });
+    }
+
+    function offsetOf(url) {
+        return request('HEAD', url, {}, null).then(function (xhr) {
+            if (xhr.status !== 200) {
+                throw fail(xhr);
+            }
+            return parseInt(xhr.getResponseHeader('Upload-Offset'), 10);
+        });
+    }
+
+    // send uploads file from offset to the end, retrying with backoff when
+    // the connection drops.
+    function send(file, url, offset, onProgress, attempt) {
+        if (offset >= file.size) {
+            return Promise.resolve();
+        }
+        var chunk = file.slice(offset, offset + CHUNK_SIZE);
+        return request('PATCH', url, {
+            'Upload-Offset': String(offset),
+            'Content-Type': 'application/offset+octet-stream'
+        }, chunk, function (loaded) { onProgress(offset + loaded); }).then(function (xhr) {
+            if (xhr.status === 204) {
+                return send(file, url, parseInt(xhr.getResponseHeader('Upload-Offset'), 10), onProgress, 0);
+            }
+            if (xhr.status < 500 && xhr.status !== 409 && xhr.status !== 423) {
+                throw fail(xhr);
+            }
+            return retry(file, url, onProgress, attempt, fail(xhr));
+        }, function (err) {
+            return retry(file, url, onProgress, attempt, err);
+        });
+    }
+
+    // finished reports whether the upload at url already became media, in
+    // case the response to its last chunk was lost.
+    function finished(url) {
+        var id = url.substring(url.lastIndexOf('/') + 1);
+        return request('HEAD', '/media/' + id + '/video', {}, null).then(function (xhr) {
+            return xhr.status === 200;
+        });
+    }
+
+    function retry(file, url, onProgress, attempt, err) {
+        if (attempt >= RETRY_DELAYS.length) {
+            return Promise.reject(err);
+        }
+        return wait(RETRY_DELAYS[attempt]).then(function () {
+            return offsetOf(url);
+        }).then(function (offset) {
+            return send(file, url, offset, onProgress, attempt + 1);
+        }, function (headErr) {
+            if (headErr.status === 404) {
+                return finished(url).then(function (done) {
+                    if (!done) {
+                        throw headErr;
+                    }
+                });
+            }
+            if (headErr.status) {
+                throw headErr;
+            }
+            return retry(file, url, onProgress, attempt + 1, headErr);
+        });
+    }
+
+    function showProgress(percent) {
+        document.querySelector('#upload-progress-container').classList.add('htmx-request');
+        document.querySelector('#upload-progress-bar').style.width = percent + '%';
+        document.querySelector('#upload-percent').innerText = Math.round(percent) + '%';
+        document.querySelector('#upload-status').style.display = 'block';
+    }
+
+    function hideProgress() {
+        document.querySelector('#upload-progress-container').classList.remove('htmx-request');
+        document.querySelector('#upload-status').style.display = 'none';
+        document.querySelector('#upload-progress-bar').style.width = '0%';
+    }
+
+    function showError(message) {
+        var div = document.createElement('div');
+        div.className = 'error';
+        div.textContent = message;
+        var container = document.querySelector('#video-container');
+        container.innerHTML = '';
+        container.appendChild(div);
+    }
+
+    document.addEventListener('submit', function (evt) {
+        var form = evt.target;
+        if (form.id !== 'upload-form') {
+            return;
+        }
+        evt.preventDefault();
+        var file = form.querySelector('input[name="videoFile"]').files[0];
+        if (!file) {
+            showError('Select a video file first');
+            return;
+        }
+        var button = form.querySelector('button[type="submit"]');
+        button.disabled = true;
+
+        var url;
+        showProgress(0);
+        start(file).then(function (u) {
+            url = u;
+            return offsetOf(url);
+        }).then(function (offset) {
+            return send(file, url, offset, function (loaded) {
+                showProgress(file.size ? loaded / file.size * 100 : 100);
+            }, 0);
+        }).then(function () {
+            localStorage.removeItem(storageKey(file));
+            // The media ID is the upload ID
+            var id = url.substring(url.lastIndexOf('/') + 1);
+            return htmx.ajax('GET', '/media/' + id, { target: '#video-container' });
+        }).catch(function (err) {
+            showError(err.message);
+        }).then(function () {
+            hideProgress();
+            button.disabled = false;
+        });
+    });
+})();